@@ -3,9 +3,12 @@ module github.com/uservers/baggr
 go 1.23.4
 
 require (
+	github.com/klauspost/compress v1.17.11
 	github.com/liamg/memoryfs v1.6.0
 	github.com/spf13/cobra v1.8.1
+	github.com/ulikunitz/xz v0.5.12
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -16,11 +19,10 @@ require (
 	github.com/rogpeppe/go-internal v1.11.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
 require (
-	github.com/blang/semver/v4 v4.0.0 // indirect
+	github.com/blang/semver/v4 v4.0.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/sys v0.24.0 // indirect
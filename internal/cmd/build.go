@@ -7,14 +7,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"github.com/uservers/baggr/pkg/build"
 	"github.com/uservers/baggr/pkg/builder"
+	"github.com/uservers/baggr/pkg/rpm"
+	"github.com/uservers/baggr/pkg/spec"
 )
 
 func addBuild(parentCmd *cobra.Command) {
 	opts := build.Default
+	vars := []string{}
+	packageTypes := []string{}
+	for _, t := range opts.PackageTypes {
+		packageTypes = append(packageTypes, string(t))
+	}
 
 	buildCmd := &cobra.Command{
 		Short:             fmt.Sprintf("%s build: build OS packages", appname),
@@ -30,6 +38,21 @@ func addBuild(parentCmd *cobra.Command) {
 				}
 				opts.ManifestPath = args[0]
 			}
+			opts.PackageTypes = []spec.PackageType{}
+			for _, t := range packageTypes {
+				opts.PackageTypes = append(opts.PackageTypes, spec.PackageType(t))
+			}
+			opts.Vars = map[string]string{}
+			for _, v := range vars {
+				key, value, ok := strings.Cut(v, "=")
+				if !ok || key == "" {
+					return fmt.Errorf("invalid variable %q, use --set key=value", v)
+				}
+				opts.Vars[key] = value
+			}
+			if opts.ReleaseFrom != "" && cmd.Flags().Changed("release") {
+				return errors.New("cannot set --release and --release-from at the same time")
+			}
 			if err := opts.Validate(); err != nil {
 				return fmt.Errorf("validating options: %w", err)
 			}
@@ -45,10 +68,60 @@ func addBuild(parentCmd *cobra.Command) {
 		&opts.ManifestPath, "manifest", "m", "", "path to the package manifest",
 	)
 	buildCmd.PersistentFlags().StringVarP(
-		&opts.Version.String, "version", "v", "", "version to set in the package",
+		&opts.Version.String, "version", "v", "", "version to set in the package, computed from the git tags if not set",
 	)
 	buildCmd.PersistentFlags().StringVarP(
 		&opts.Version.Release, "release", "r", "0", "release to set in the package",
 	)
+	buildCmd.PersistentFlags().StringVar(
+		&opts.ReleaseFrom, "release-from", "",
+		"directory of built packages or repository metadata used to compute the next release",
+	)
+	buildCmd.PersistentFlags().StringSliceVarP(
+		&packageTypes, "type", "t", packageTypes, "package types to build (rpm, deb, apk, pacman, tar.gz, tar.zst, zip, oci, oci-archive)",
+	)
+	buildCmd.PersistentFlags().StringVar(
+		&opts.SourceDir, "source-dir", "", "directory where relative sources are read from, defaults to the manifest directory",
+	)
+	buildCmd.PersistentFlags().StringVar(
+		&opts.SourceRef, "source-ref", "", "git revision of the source directory to read the files from instead of the working tree",
+	)
+	buildCmd.PersistentFlags().BoolVar(
+		&opts.AllowDirty, "allow-dirty", false, "build from --source-ref even if the working tree has changes not committed",
+	)
+	buildCmd.PersistentFlags().StringSliceVar(
+		&opts.SourceRoots, "source-root", []string{},
+		"directories where the manifest sources are looked up before the source directory",
+	)
+	buildCmd.PersistentFlags().StringSliceVar(
+		&opts.SourceArchives, "source-archive", []string{},
+		"tar or zip archives, or rpm and deb packages, where the manifest sources are looked up before the source directory",
+	)
+	buildCmd.PersistentFlags().IntVar(
+		&opts.StripComponents, "strip-components", 0, "number of leading path elements removed from the files of the source archives",
+	)
+	buildCmd.PersistentFlags().StringVar(
+		&opts.CacheDir, "cache-dir", "", "directory where the manifest sources are downloaded, defaults to the user cache",
+	)
+	buildCmd.PersistentFlags().BoolVar(
+		&opts.AllowAbsoluteSources, "allow-absolute-sources", false, "allow reading sources from absolute paths",
+	)
+	buildCmd.PersistentFlags().StringVarP(
+		&opts.OutputDir, "output-dir", "o", opts.OutputDir, "directory where the packages are written",
+	)
+	buildCmd.PersistentFlags().StringVar(
+		&opts.RpmBackend, "rpm-backend", rpm.BackendAuto,
+		fmt.Sprintf("how to build rpms: %s, %s or %s", rpm.BackendAuto, rpm.BackendRpmbuild, rpm.BackendNative),
+	)
+	buildCmd.PersistentFlags().StringVar(
+		&opts.RpmCompression, "rpm-compression", rpm.CompressionXz,
+		fmt.Sprintf("payload compression of natively built rpms: %s or %s", rpm.CompressionXz, rpm.CompressionZstd),
+	)
+	buildCmd.PersistentFlags().StringArrayVar(
+		&vars, "set", []string{}, "manifest variable as key=value, overrides the manifest and the environment, can be repeated",
+	)
+	buildCmd.PersistentFlags().StringVar(
+		&opts.ApkKey, "apk-key", "", "RSA private key to sign apk packages",
+	)
 	parentCmd.AddCommand(buildCmd)
 }
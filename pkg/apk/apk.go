@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package apk is a baggr implementation that builds Alpine packages
+package apk
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func New() *Worker {
+	return &Worker{
+		implementation: &defaultImplementation{},
+	}
+}
+
+type Worker struct {
+	implementation Implementation
+}
+
+// BuildPackages takes a manifest and builds an apk for the main component
+// and one for each of its subcomponents.
+func (w *Worker) BuildPackages(ctx context.Context, manifest *spec.Manifest, opts *build.Options) (build.Result, error) {
+	var results build.Result
+	// Create a temp directory to stage the package files
+	tmp, err := os.MkdirTemp("", "baggr-apkroot-*")
+	if err != nil {
+		return results, fmt.Errorf("creating temporary staging directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	sourceWriter := source.NewDirWriter(tmp)
+
+	if err := w.implementation.CopySourceFiles(ctx, opts, sourceWriter, manifest); err != nil {
+		return results, fmt.Errorf("copying package files: %w", err)
+	}
+
+	results, err = w.implementation.BuildApks(ctx, opts, sourceWriter, manifest)
+	if err != nil {
+		return results, fmt.Errorf("packaging apks: %w", err)
+	}
+
+	return results, nil
+}
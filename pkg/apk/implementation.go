@@ -0,0 +1,415 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // apk v2 signatures and file checksums use SHA1
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+const (
+	architecture = "noarch"
+
+	// paxChecksum is the PAX record where apk-tools expects file checksums
+	paxChecksum = "APK-TOOLS.checksum.SHA1"
+)
+
+type Implementation interface {
+	CopySourceFiles(context.Context, *build.Options, source.Writer, *spec.Manifest) error
+	BuildApks(context.Context, *build.Options, source.Writer, *spec.Manifest) (build.Result, error)
+}
+
+type defaultImplementation struct{}
+
+// pkgInfo holds the package metadata written to .PKGINFO
+type pkgInfo struct {
+	Name        string
+	Version     string
+	Description string
+	URL         string
+	License     string
+	Packager    string
+	Origin      string
+	BuildDate   int64
+	Size        int64
+	Depends     []string
+	Provides    []string
+	Replaces    []string
+	DataHash    string
+}
+
+// String renders the .PKGINFO file
+func (pi *pkgInfo) String() string {
+	var b strings.Builder
+	b.WriteString("# Generated by baggr\n")
+	fmt.Fprintf(&b, "pkgname = %s\n", pi.Name)
+	fmt.Fprintf(&b, "pkgver = %s\n", pi.Version)
+	fmt.Fprintf(&b, "pkgdesc = %s\n", pi.Description)
+	if pi.URL != "" {
+		fmt.Fprintf(&b, "url = %s\n", pi.URL)
+	}
+	fmt.Fprintf(&b, "builddate = %d\n", pi.BuildDate)
+	if pi.Packager != "" {
+		fmt.Fprintf(&b, "packager = %s\n", pi.Packager)
+	}
+	fmt.Fprintf(&b, "size = %d\n", pi.Size)
+	fmt.Fprintf(&b, "arch = %s\n", architecture)
+	fmt.Fprintf(&b, "origin = %s\n", pi.Origin)
+	if pi.License != "" {
+		fmt.Fprintf(&b, "license = %s\n", pi.License)
+	}
+	for _, d := range pi.Depends {
+		fmt.Fprintf(&b, "depend = %s\n", d)
+	}
+	for _, p := range pi.Provides {
+		fmt.Fprintf(&b, "provides = %s\n", p)
+	}
+	for _, r := range pi.Replaces {
+		fmt.Fprintf(&b, "replaces = %s\n", r)
+	}
+	fmt.Fprintf(&b, "datahash = %s\n", pi.DataHash)
+	return b.String()
+}
+
+// signer signs the control segment of the packages
+type signer struct {
+	key  *rsa.PrivateKey
+	name string
+}
+
+// CopySourceFiles copies the files from the source reader using the source writer
+func (di *defaultImplementation) CopySourceFiles(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) error {
+	return staging.CopyFiles(ctx, opts, sourceWriter, manifest)
+}
+
+// BuildApks writes an apk for the main component and one for each of the
+// subcomponents that has files. Packages are signed when a key is set in
+// the options.
+func (di *defaultImplementation) BuildApks(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) (results build.Result, err error) {
+	results = build.Result{Artifacts: []build.Artifact{}}
+	if len(manifest.Files) == 0 {
+		return results, fmt.Errorf("unable to build apk, no files defined in top level project")
+	}
+
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return results, fmt.Errorf("resolving package version: %w", err)
+	}
+	release := ver.Release
+	if release == "" {
+		release = "0"
+	}
+	pkgver := fmt.Sprintf("%s-r%s", version.TranslateAPK(ver.String), release)
+
+	var sig *signer
+	if opts.ApkKey != "" {
+		if sig, err = loadSigner(opts.ApkKey); err != nil {
+			return results, fmt.Errorf("loading signing key: %w", err)
+		}
+	}
+
+	for i, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		name := manifest.Name
+		if i > 0 {
+			if len(c.Files) == 0 {
+				logrus.Infof("Component %s not packaged because it does not provide any files", c.Name)
+				continue
+			}
+			name = fmt.Sprintf("%s-%s", manifest.Name, c.Name)
+		}
+
+		entries, err := staging.Collect(sourceWriter.Path(), c)
+		if err != nil {
+			return results, fmt.Errorf("reading files of %s: %w", name, err)
+		}
+		entries = staging.WithoutGhosts(entries)
+
+		description := c.Summary
+		if description == "" {
+			description = manifest.Summary
+		}
+
+		info := &pkgInfo{
+			Name:        name,
+			Version:     pkgver,
+			Description: description,
+			URL:         manifest.URL,
+			License:     c.License,
+			Packager:    manifest.Maintainer,
+			Origin:      manifest.Name,
+			BuildDate:   time.Now().Unix(),
+			Depends:     relationDepends(name, c),
+			Provides:    depends(c.Provides),
+			Replaces:    names(c.Obsoletes),
+		}
+		if info.License == "" {
+			info.License = manifest.License
+		}
+
+		apkPath := filepath.Join(opts.OutputDir, fmt.Sprintf("%s-%s.apk", name, pkgver))
+		if err := writeApk(apkPath, info, entries, installScripts(name, &c.Scripts), sig); err != nil {
+			return results, fmt.Errorf("writing %s: %w", name, err)
+		}
+		logrus.Infof("Wrote: %s", apkPath)
+		results.Artifacts = append(results.Artifacts, build.NewFileArtifact(apkPath))
+	}
+	return results, nil
+}
+
+// writeApk writes the package to path. An apk is the concatenation of the
+// gzipped signature, control and data tar segments.
+func writeApk(apkPath string, info *pkgInfo, entries []*staging.Entry, scripts []segmentFile, sig *signer) error {
+	dataFile, err := os.CreateTemp("", "baggr-apk-data-*")
+	if err != nil {
+		return fmt.Errorf("creating data file: %w", err)
+	}
+	defer func() {
+		dataFile.Close()
+		os.Remove(dataFile.Name())
+	}()
+
+	dataHash := sha256.New()
+	if err := writeData(io.MultiWriter(dataFile, dataHash), entries); err != nil {
+		return fmt.Errorf("writing data segment: %w", err)
+	}
+	info.DataHash = hex.EncodeToString(dataHash.Sum(nil))
+	for _, e := range entries {
+		if !e.IsDir() {
+			info.Size += e.Size
+		}
+	}
+
+	control, err := segment(
+		time.Unix(info.BuildDate, 0),
+		append([]segmentFile{{name: ".PKGINFO", mode: 0o644, data: []byte(info.String())}}, scripts...)...,
+	)
+	if err != nil {
+		return fmt.Errorf("writing control segment: %w", err)
+	}
+
+	f, err := os.Create(apkPath)
+	if err != nil {
+		return fmt.Errorf("creating package file: %w", err)
+	}
+	defer f.Close()
+
+	if sig != nil {
+		signature, err := sig.sign(control)
+		if err != nil {
+			return fmt.Errorf("signing package: %w", err)
+		}
+		if _, err := f.Write(signature); err != nil {
+			return fmt.Errorf("writing signature segment: %w", err)
+		}
+	}
+
+	if _, err := f.Write(control); err != nil {
+		return fmt.Errorf("writing control segment: %w", err)
+	}
+	if _, err := dataFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding data segment: %w", err)
+	}
+	if _, err := io.Copy(f, dataFile); err != nil {
+		return fmt.Errorf("copying data segment: %w", err)
+	}
+	return f.Close()
+}
+
+// writeData writes the data segment. Each file carries its checksum in a
+// PAX record as apk-tools verifies it when installing.
+func writeData(w io.Writer, entries []*staging.Entry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, e := range staging.WithParents(entries) {
+		hdr := e.TarHeader()
+		hdr.Format = tar.FormatPAX
+		if !e.IsDir() {
+			sum, err := e.Digest(sha1.New()) //nolint:gosec // checksum format required by apk
+			if err != nil {
+				return err
+			}
+			hdr.PAXRecords = map[string]string{paxChecksum: sum}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing tar header for %s: %w", e.Path, err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if err := e.CopyTo(tw); err != nil {
+				return err
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar stream: %w", err)
+	}
+	return gz.Close()
+}
+
+// segmentFile is a file written to the signature or control segments
+type segmentFile struct {
+	name string
+	mode int64
+	data []byte
+}
+
+// segment returns a gzipped tar stream with the files. The tar stream is
+// not terminated so that segments can be concatenated.
+func segment(modTime time.Time, files ...segmentFile) ([]byte, error) {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg, Name: f.name, Mode: f.mode, Size: int64(len(f.data)), ModTime: modTime,
+			Uname: staging.DefaultOwner, Gname: staging.DefaultOwner, Format: tar.FormatUSTAR,
+		}); err != nil {
+			return nil, fmt.Errorf("writing %s header: %w", f.name, err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", f.name, err)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, fmt.Errorf("flushing tar stream: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("closing gzip stream: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// installScripts returns the control files of the component scripts. The
+// install scripts also run on upgrades, as in rpm. apk has no transaction
+// hooks so pretrans and posttrans are not packaged.
+func installScripts(name string, s *spec.Scripts) []segmentFile {
+	if s.PreTrans.Defined() || s.PostTrans.Defined() {
+		logrus.Warnf("Package %s: apk packages don't support pretrans and posttrans scripts, skipping them", name)
+	}
+
+	files := []segmentFile{}
+	for _, is := range []struct {
+		names  []string
+		script *spec.Script
+	}{
+		{[]string{".pre-install", ".pre-upgrade"}, &s.PreInstall},
+		{[]string{".post-install", ".post-upgrade"}, &s.PostInstall},
+		{[]string{".pre-deinstall"}, &s.PreUninstall},
+		{[]string{".post-deinstall"}, &s.PostUninstall},
+	} {
+		if !is.script.Defined() {
+			continue
+		}
+		for _, n := range is.names {
+			files = append(files, segmentFile{name: n, mode: 0o755, data: []byte(is.script.Executable())})
+		}
+	}
+	return files
+}
+
+// loadSigner reads an RSA private key in PEM format. The public key has to
+// be installed in /etc/apk/keys with the name of the private key plus .pub
+func loadSigner(keyPath string) (*signer, error) {
+	data, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found in key file")
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var k any
+		k, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err == nil {
+			var ok bool
+			if key, ok = k.(*rsa.PrivateKey); !ok {
+				err = errors.New("key is not an RSA key")
+			}
+		}
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing key: %w", err)
+	}
+	return &signer{key: key, name: filepath.Base(keyPath) + ".pub"}, nil
+}
+
+// sign returns the signature segment for the control segment
+func (s *signer) sign(control []byte) ([]byte, error) {
+	digest := sha1.Sum(control) //nolint:gosec // apk v2 signs the SHA1 digest
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA1, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("signing control segment: %w", err)
+	}
+	return segment(time.Now(), segmentFile{name: ".SIGN.RSA." + s.name, mode: 0o644, data: signature})
+}
+
+// depends translates the manifest relations to apk dependencies,
+// eg "perl >= 5.0" becomes "perl>=5.0"
+func depends(rels spec.Relations) []string {
+	res := []string{}
+	for _, r := range rels {
+		res = append(res, r.Name+r.Operator+r.Version)
+	}
+	return res
+}
+
+// names returns the package names of the relations
+func names(rels spec.Relations) []string {
+	res := []string{}
+	for _, r := range rels {
+		res = append(res, r.Name)
+	}
+	return res
+}
+
+// relationDepends returns the depend entries of a component. Conflicts
+// and obsoleted packages are negated dependencies, apk has no weak
+// dependencies so they are not packaged.
+func relationDepends(name string, c *spec.Component) []string {
+	if len(c.Recommends) > 0 || len(c.Suggests) > 0 || len(c.Supplements) > 0 {
+		logrus.Warnf("Package %s: apk packages don't support weak dependencies, skipping them", name)
+	}
+	res := depends(c.Requires)
+	for _, d := range depends(slices.Concat(c.Conflicts, c.Obsoletes)) {
+		res = append(res, "!"+d)
+	}
+	return res
+}
@@ -0,0 +1,160 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package apk
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // apk v2 signatures use SHA1
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging/stagingtest"
+)
+
+// splitSegments returns the gzip streams concatenated in an apk
+func splitSegments(t *testing.T, data []byte) [][]byte {
+	t.Helper()
+	res := [][]byte{}
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		start := len(data) - r.Len()
+		zr, err := gzip.NewReader(r)
+		require.NoError(t, err)
+		zr.Multistream(false)
+		_, err = io.Copy(io.Discard, zr)
+		require.NoError(t, err)
+		res = append(res, data[start:len(data)-r.Len()])
+	}
+	return res
+}
+
+// segmentFiles returns the tar headers of the files in a segment
+func segmentFiles(t *testing.T, seg []byte) map[string]*tar.Header {
+	t.Helper()
+	zr, err := gzip.NewReader(bytes.NewReader(seg))
+	require.NoError(t, err)
+	tr := tar.NewReader(zr)
+	res := map[string]*tar.Header{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		res[hdr.Name] = hdr
+	}
+	return res
+}
+
+func TestBuildApks(t *testing.T) {
+	t.Parallel()
+	ctx := stagingtest.Context("1.0.0", "2")
+	swTemp := stagingtest.Dir(t, nil)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "test.rsa")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{
+		Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}), os.FileMode(0o600)))
+
+	man := stagingtest.Manifest()
+	man.Requires = spec.Relations{{Name: "bash", Operator: ">=", Version: "4.0"}}
+	man.Provides = spec.Relations{{Name: "test-tools", Operator: "=", Version: "1.0"}}
+	man.Conflicts = spec.Relations{{Name: "other-test", Operator: "<", Version: "2"}}
+	man.Obsoletes = spec.Relations{{Name: "old-test"}}
+
+	for _, tc := range []struct {
+		name    string
+		keyPath string
+		signed  bool
+	}{
+		{"unsigned", "", false},
+		{"signed", keyPath, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			di := defaultImplementation{}
+			res, err := di.BuildApks(
+				ctx, &build.Options{OutputDir: t.TempDir(), ApkKey: tc.keyPath}, source.NewDirWriter(swTemp), man,
+			)
+			require.NoError(t, err)
+			require.Len(t, res.Artifacts, 1)
+			require.Equal(t, "test-1.0.0-r2.apk", filepath.Base(res.Artifacts[0].Path()))
+
+			data, err := os.ReadFile(res.Artifacts[0].Path())
+			require.NoError(t, err)
+			segments := splitSegments(t, data)
+
+			if tc.signed {
+				require.Len(t, segments, 3)
+				sigFiles := segmentFiles(t, segments[0])
+				require.Contains(t, sigFiles, ".SIGN.RSA.test.rsa.pub")
+
+				zr, err := gzip.NewReader(bytes.NewReader(segments[0]))
+				require.NoError(t, err)
+				tr := tar.NewReader(zr)
+				_, err = tr.Next()
+				require.NoError(t, err)
+				signature, err := io.ReadAll(tr)
+				require.NoError(t, err)
+				digest := sha1.Sum(segments[1]) //nolint:gosec // apk v2 signatures use SHA1
+				require.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA1, digest[:], signature))
+				segments = segments[1:]
+			}
+			require.Len(t, segments, 2)
+			require.Contains(t, segmentFiles(t, segments[0]), ".PKGINFO")
+
+			dataFiles := segmentFiles(t, segments[1])
+			require.Contains(t, dataFiles, "usr/bin/")
+			require.Contains(t, dataFiles, "usr/bin/test")
+			require.Equal(t, int64(0o755), dataFiles["usr/bin/test"].Mode)
+			require.NotEmpty(t, dataFiles["usr/bin/test"].PAXRecords[paxChecksum])
+
+			sum := sha256.Sum256(segments[1])
+			zr, err := gzip.NewReader(bytes.NewReader(segments[0]))
+			require.NoError(t, err)
+			tr := tar.NewReader(zr)
+			_, err = tr.Next()
+			require.NoError(t, err)
+			pkginfo, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			require.Contains(t, string(pkginfo), "pkgver = 1.0.0-r2\n")
+			require.Contains(t, string(pkginfo), "depend = bash>=4.0\ndepend = !other-test<2\ndepend = !old-test\n")
+			require.Contains(t, string(pkginfo), "provides = test-tools=1.0\nreplaces = old-test\n")
+			require.Contains(t, string(pkginfo), "datahash = "+hex.EncodeToString(sum[:])+"\n")
+		})
+	}
+}
+
+func TestInstallScripts(t *testing.T) {
+	t.Parallel()
+	files := installScripts("test", &spec.Scripts{
+		PostInstall:   spec.Script{Inline: "rc-update add test"},
+		PostUninstall: spec.Script{Inline: "#!/bin/bash\necho bye\n"},
+	})
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.name)
+		require.Equal(t, int64(0o755), f.mode)
+	}
+	require.Equal(t, []string{".post-install", ".post-upgrade", ".post-deinstall"}, names)
+	require.Equal(t, "#!/bin/sh\nrc-update add test\n", string(files[0].data))
+	require.Equal(t, "#!/bin/bash\necho bye\n", string(files[2].data))
+}
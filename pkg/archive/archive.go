@@ -0,0 +1,62 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package archive is a baggr implementation that writes the staged files
+// of each component to a plain archive instead of an OS package.
+package archive
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// Format is the type of archive written by the worker
+type Format string
+
+const (
+	FormatTarGz  Format = "tar.gz"
+	FormatTarZst Format = "tar.zst"
+	FormatZip    Format = "zip"
+)
+
+// New returns a worker that writes archives in the specified format
+func New(format Format) *Worker {
+	return &Worker{
+		format:         format,
+		implementation: &defaultImplementation{},
+	}
+}
+
+type Worker struct {
+	format         Format
+	implementation Implementation
+}
+
+// BuildPackages takes a manifest and writes an archive with the files of
+// the main component and one for each of its subcomponents.
+func (w *Worker) BuildPackages(ctx context.Context, manifest *spec.Manifest, opts *build.Options) (build.Result, error) {
+	var results build.Result
+	// Create a temp directory to stage the files
+	tmp, err := os.MkdirTemp("", "baggr-archiveroot-*")
+	if err != nil {
+		return results, fmt.Errorf("creating temporary staging directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	sourceWriter := source.NewDirWriter(tmp)
+
+	if err := w.implementation.CopySourceFiles(ctx, opts, sourceWriter, manifest); err != nil {
+		return results, fmt.Errorf("copying archive files: %w", err)
+	}
+
+	results, err = w.implementation.BuildArchives(ctx, opts, sourceWriter, manifest, w.format)
+	if err != nil {
+		return results, fmt.Errorf("writing %s archives: %w", w.format, err)
+	}
+
+	return results, nil
+}
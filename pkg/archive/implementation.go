@@ -0,0 +1,183 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+)
+
+// zipUnixExtraID is the id of the Info-ZIP unix extra field ("ux") that
+// stores the owner of the files
+const zipUnixExtraID = 0x7875
+
+type Implementation interface {
+	CopySourceFiles(context.Context, *build.Options, source.Writer, *spec.Manifest) error
+	BuildArchives(context.Context, *build.Options, source.Writer, *spec.Manifest, Format) (build.Result, error)
+}
+
+type defaultImplementation struct{}
+
+// CopySourceFiles copies the files from the source reader using the source writer
+func (di *defaultImplementation) CopySourceFiles(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) error {
+	return staging.CopyFiles(ctx, opts, sourceWriter, manifest)
+}
+
+// BuildArchives writes an archive for the main component and one for each
+// subcomponent with files. File paths in the archives are relative to the
+// root directory.
+func (di *defaultImplementation) BuildArchives(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest, format Format,
+) (results build.Result, err error) {
+	results = build.Result{Artifacts: []build.Artifact{}}
+
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return results, fmt.Errorf("resolving version: %w", err)
+	}
+
+	for i, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		name := manifest.Name
+		if i > 0 {
+			name = fmt.Sprintf("%s-%s", manifest.Name, c.Name)
+		}
+		if len(c.Files) == 0 {
+			logrus.Infof("Component %s not archived because it does not provide any files", name)
+			continue
+		}
+
+		entries, err := staging.Collect(sourceWriter.Path(), c)
+		if err != nil {
+			return results, fmt.Errorf("reading files of %s: %w", name, err)
+		}
+		entries = staging.WithoutGhosts(entries)
+
+		archivePath := filepath.Join(opts.OutputDir, fmt.Sprintf("%s-%s.%s", name, ver.String, format))
+		if err := writeArchive(archivePath, format, staging.WithParents(entries)); err != nil {
+			return results, fmt.Errorf("writing %s: %w", archivePath, err)
+		}
+		logrus.Infof("Wrote: %s", archivePath)
+		results.Artifacts = append(results.Artifacts, build.NewFileArtifact(archivePath))
+	}
+	return results, nil
+}
+
+// writeArchive writes the entries to an archive file in the specified format
+func writeArchive(archivePath string, format Format, entries []*staging.Entry) error {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("creating archive file: %w", err)
+	}
+	defer f.Close()
+
+	switch format {
+	case FormatTarGz:
+		gz := gzip.NewWriter(f)
+		if err := writeTar(gz, entries); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("closing gzip stream: %w", err)
+		}
+	case FormatTarZst:
+		zw, err := zstd.NewWriter(f)
+		if err != nil {
+			return fmt.Errorf("creating zstd writer: %w", err)
+		}
+		if err := writeTar(zw, entries); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("closing zstd stream: %w", err)
+		}
+	case FormatZip:
+		if err := writeZip(f, entries); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported archive format %q", format)
+	}
+	return f.Close()
+}
+
+func writeTar(w io.Writer, entries []*staging.Entry) error {
+	tw := tar.NewWriter(w)
+	if err := staging.WriteTar(tw, "", entries); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar stream: %w", err)
+	}
+	return nil
+}
+
+// writeZip writes the entries to a zip archive. Modes are stored in the
+// external attributes and owners in the Info-ZIP unix extra field.
+func writeZip(w io.Writer, entries []*staging.Entry) error {
+	zw := zip.NewWriter(w)
+	for _, e := range entries {
+		hdr := &zip.FileHeader{
+			Name:     strings.TrimPrefix(e.Path, "/"),
+			Method:   zip.Deflate,
+			Modified: e.ModTime,
+			Extra:    zipUnixExtra(e.UID, e.GID),
+		}
+		hdr.SetMode(e.Mode)
+		if e.IsDir() {
+			hdr.Name += "/"
+			hdr.Method = zip.Store
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("writing zip header for %s: %w", e.Path, err)
+		}
+
+		switch {
+		case e.IsSymlink():
+			if _, err := io.WriteString(fw, e.Linkname); err != nil {
+				return fmt.Errorf("writing link target: %w", err)
+			}
+		case e.Mode.IsRegular():
+			if err := e.CopyTo(fw); err != nil {
+				return err
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing zip archive: %w", err)
+	}
+	return nil
+}
+
+// zipUnixExtra returns the "ux" extra field with the file owner
+func zipUnixExtra(uid, gid int) []byte {
+	extra := make([]byte, 15)
+	binary.LittleEndian.PutUint16(extra[0:], zipUnixExtraID)
+	binary.LittleEndian.PutUint16(extra[2:], 11) // Size of the data
+	extra[4] = 1                                 // Version
+	extra[5] = 4                                 // Size of the UID
+	binary.LittleEndian.PutUint32(extra[6:], uint32(uid))
+	extra[10] = 4 // Size of the GID
+	binary.LittleEndian.PutUint32(extra[11:], uint32(gid))
+	return extra
+}
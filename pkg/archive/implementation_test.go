@@ -0,0 +1,123 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging/stagingtest"
+)
+
+// archiveFile is the data we check from the archive entries
+type archiveFile struct {
+	mode fs.FileMode
+	uid  int
+}
+
+func readTar(t *testing.T, r io.Reader) map[string]archiveFile {
+	t.Helper()
+	res := map[string]archiveFile{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		res[hdr.Name] = archiveFile{mode: hdr.FileInfo().Mode(), uid: hdr.Uid}
+	}
+	return res
+}
+
+func readZip(t *testing.T, path string) map[string]archiveFile {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer zr.Close()
+	res := map[string]archiveFile{}
+	for _, f := range zr.File {
+		// The zip writer appends its own timestamp field, look for ours
+		uid := -1
+		for extra := f.Extra; len(extra) >= 4; {
+			size := int(binary.LittleEndian.Uint16(extra[2:]))
+			if binary.LittleEndian.Uint16(extra) == zipUnixExtraID {
+				uid = int(binary.LittleEndian.Uint32(extra[6:]))
+			}
+			extra = extra[4+size:]
+		}
+		require.NotEqual(t, -1, uid, "no unix extra field in %s", f.Name)
+		res[f.Name] = archiveFile{mode: f.Mode(), uid: uid}
+	}
+	return res
+}
+
+func TestBuildArchives(t *testing.T) {
+	t.Parallel()
+	ctx := stagingtest.Context("1.0.0", "")
+	swTemp := stagingtest.Dir(t, map[string]string{"docs/index.html": "hey"})
+
+	man := stagingtest.Manifest()
+	man.Files[0].Mode, man.Files[0].UID = "0750", "1000"
+	man.Components = []*spec.Component{
+		{Name: "docs", Files: []*spec.File{{Source: "docs", Destination: "/docs"}}},
+	}
+
+	expected := map[string]archiveFile{
+		"usr/":         {mode: fs.ModeDir | 0o755},
+		"usr/bin/":     {mode: fs.ModeDir | 0o755},
+		"usr/bin/test": {mode: 0o750, uid: 1000},
+	}
+
+	for _, tc := range []struct {
+		format Format
+		read   func(*testing.T, string) map[string]archiveFile
+	}{
+		{FormatTarGz, func(t *testing.T, path string) map[string]archiveFile {
+			t.Helper()
+			f, err := os.Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+			gz, err := gzip.NewReader(f)
+			require.NoError(t, err)
+			return readTar(t, gz)
+		}},
+		{FormatTarZst, func(t *testing.T, path string) map[string]archiveFile {
+			t.Helper()
+			f, err := os.Open(path)
+			require.NoError(t, err)
+			defer f.Close()
+			zr, err := zstd.NewReader(f)
+			require.NoError(t, err)
+			defer zr.Close()
+			return readTar(t, zr)
+		}},
+		{FormatZip, readZip},
+	} {
+		t.Run(string(tc.format), func(t *testing.T) {
+			t.Parallel()
+			di := defaultImplementation{}
+			res, err := di.BuildArchives(
+				ctx, &build.Options{OutputDir: t.TempDir()}, source.NewDirWriter(swTemp), man, tc.format,
+			)
+			require.NoError(t, err)
+			require.Len(t, res.Artifacts, 2)
+			require.Equal(t, "test-1.0.0."+string(tc.format), filepath.Base(res.Artifacts[0].Path()))
+			require.Equal(t, "test-docs-1.0.0."+string(tc.format), filepath.Base(res.Artifacts[1].Path()))
+			require.Equal(t, expected, tc.read(t, res.Artifacts[0].Path()))
+		})
+	}
+}
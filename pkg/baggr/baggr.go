@@ -3,13 +3,26 @@ package baggr
 import (
 	"context"
 
+	"github.com/uservers/baggr/pkg/apk"
+	"github.com/uservers/baggr/pkg/archive"
 	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/deb"
+	"github.com/uservers/baggr/pkg/oci"
+	"github.com/uservers/baggr/pkg/pacman"
 	"github.com/uservers/baggr/pkg/rpm"
 	"github.com/uservers/baggr/pkg/spec"
 )
 
 var WorkerTypes = map[spec.PackageType]Worker{
-	spec.PackageTypeRPM: rpm.New(),
+	spec.PackageTypeRPM:        rpm.New(),
+	spec.PackageTypeDeb:        deb.New(),
+	spec.PackageTypeAPK:        apk.New(),
+	spec.PackageTypePacman:     pacman.New(),
+	spec.PackageTypeTarGz:      archive.New(archive.FormatTarGz),
+	spec.PackageTypeTarZst:     archive.New(archive.FormatTarZst),
+	spec.PackageTypeZip:        archive.New(archive.FormatZip),
+	spec.PackageTypeOCI:        oci.New(oci.FormatLayout),
+	spec.PackageTypeOCIArchive: oci.New(oci.FormatArchive),
 }
 
 type Worker interface {
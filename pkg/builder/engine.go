@@ -5,10 +5,8 @@ package builder
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"io/fs"
-	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/sirupsen/logrus"
@@ -16,6 +14,8 @@ import (
 	"github.com/uservers/baggr/pkg/build"
 	"github.com/uservers/baggr/pkg/source"
 	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/version"
 )
 
 func New() *Engine {
@@ -39,24 +39,55 @@ func (eng *Engine) Build(ctx context.Context, opts *build.Options) error {
 	ctx = context.WithValue(ctx, build.ContextKey{}, buildContext)
 
 	// Read the package manifest
-	manifest, err := eng.implementation.ParseManifest(ctx, opts.ManifestPath)
+	manifest, err := eng.implementation.ParseManifest(ctx, opts.ManifestPath, opts.Vars)
 	if err != nil {
 		return fmt.Errorf("parsing manifest: %w", err)
 	}
 
 	logrus.Infof("Manifest: \n%+v", manifest)
 
-	reader, err := getSourceReader(manifest)
+	// Relative paths in the manifest are read from its directory
+	buildContext.ManifestDir, err = filepath.Abs(filepath.Dir(opts.ManifestPath))
+	if err != nil {
+		return fmt.Errorf("getting manifest directory: %w", err)
+	}
+
+	reader, err := getSourceReader(ctx, manifest, opts, buildContext.ManifestDir)
 	if err != nil {
 		return fmt.Errorf("getting reader: %w", err)
 	}
 	opts.SourceReader = reader
 
+	if opts.VersionReader == nil {
+		opts.VersionReader = getVersionReader(manifest, opts.ManifestPath)
+	}
+
 	// ENsure we have a version to work with
 	if err := eng.implementation.EnsureVersion(ctx, opts); err != nil {
 		return fmt.Errorf("ensuring package versions: %w", err)
 	}
 
+	if err := eng.implementation.EnsureRelease(ctx, opts, manifest); err != nil {
+		return fmt.Errorf("ensuring package release: %w", err)
+	}
+
+	// Run the build steps to produce the files before they are copied
+	if err := eng.implementation.RunBuildSteps(ctx, opts, manifest); err != nil {
+		return fmt.Errorf("running build steps: %w", err)
+	}
+
+	// Fail early when sources are missing, before building any package
+	if err := eng.implementation.CheckSourceFiles(ctx, opts, manifest); err != nil {
+		return fmt.Errorf("checking source files: %w", err)
+	}
+
+	// Files marked as templates are rendered with the resolved version
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("resolving version: %w", err)
+	}
+	ctx = source.WithTemplateData(ctx, &source.TemplateData{Manifest: manifest, Version: ver, Vars: manifest.Vars})
+
 	// Cycle all packagte types and build them
 	for _, t := range opts.PackageTypes {
 		worker := eng.GetPackageWorker(t)
@@ -74,20 +105,140 @@ func (eng *Engine) Build(ctx context.Context, opts *build.Options) error {
 }
 
 // getSourceReader returns a source.Reader appropriate for the files defined
-// in the manifest.
-func getSourceReader(manifest *spec.Manifest) (source.Reader, error) {
-	for _, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
-		for _, f := range c.Files {
-			if f.Source != "%DIR%" && strings.HasPrefix(f.Source, "/") {
-				return nil, errors.New("cannot build a proper fs source for now (found absolute paths)")
+// in the manifest. Relative paths are looked up in the outputs of the build
+// steps, the manifest sources, the source roots and archives of the options
+// and then in the source directory, which defaults to the directory of the
+// manifest. Directories are listed from the first root where they exist,
+// outputs written to directories of another root must be declared as files.
+func getSourceReader(ctx context.Context, manifest *spec.Manifest, opts *build.Options, manifestDir string) (source.Reader, error) {
+	if !opts.AllowAbsoluteSources {
+		for _, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+			for _, f := range c.Files {
+				if f.Source != spec.DirSource && strings.HasPrefix(f.Source, "/") {
+					return nil, fmt.Errorf("found absolute source %s, use --allow-absolute-sources to read it", f.Source)
+				}
 			}
 		}
 	}
 
-	if sfs, ok := os.DirFS(".").(fs.StatFS); ok {
-		return source.NewFilesystemReader(sfs), nil
+	sourceDir, name := manifestDir, "manifest directory"
+	if opts.SourceDir != "" {
+		sourceDir, name = opts.SourceDir, opts.SourceDir
+	}
+
+	// The build steps write their outputs to the manifest directory. They
+	// are read from there first unless the source directory is the same
+	// tree, which already has them next to the rest of the files.
+	roots := []source.Root{}
+	outputs := buildOutputs(manifest)
+	sameDir, err := sameDirectory(sourceDir, manifestDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) > 0 && (opts.SourceRef != "" || !sameDir) {
+		fsr := source.NewFilesystemReader(source.DirFS(manifestDir))
+		roots = append(roots, source.Root{Name: "build outputs", Reader: source.NewPathsReader(fsr, outputs...)})
+	}
+	if len(manifest.Sources) > 0 {
+		rr, err := getRemoteSourceReader(ctx, manifest, opts)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, source.Root{Name: "manifest sources", Reader: rr})
+	}
+	for _, dir := range opts.SourceRoots {
+		roots = append(roots, source.Root{Name: dir, Reader: source.NewFilesystemReader(source.DirFS(dir))})
+	}
+	for _, archive := range opts.SourceArchives {
+		ar, err := source.NewArchiveReader(archive, opts.StripComponents)
+		if err != nil {
+			return nil, fmt.Errorf("opening source archive: %w", err)
+		}
+		roots = append(roots, source.Root{Name: archive, Reader: ar})
+	}
+	if opts.SourceRef == "" {
+		roots = append(roots, source.Root{Name: name, Reader: source.NewFilesystemReader(source.DirFS(sourceDir))})
+	} else {
+		gr, err := getGitSourceReader(sourceDir, opts)
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, source.Root{Name: fmt.Sprintf("%s at %s", name, opts.SourceRef), Reader: gr})
+	}
+
+	reader := source.NewMultiReader(roots...)
+	if opts.AllowAbsoluteSources {
+		reader.Absolute = source.NewFilesystemReader(source.DirFS("/"))
+	}
+	return reader, nil
+}
+
+// sameDirectory returns true if both paths point to the same directory
+func sameDirectory(a, b string) (bool, error) {
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, fmt.Errorf("getting absolute path of %s: %w", a, err)
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, fmt.Errorf("getting absolute path of %s: %w", b, err)
+	}
+	return absA == absB, nil
+}
+
+// getRemoteSourceReader returns a reader of the sources of the manifest.
+// The sources are downloaded before building to fail early.
+func getRemoteSourceReader(ctx context.Context, manifest *spec.Manifest, opts *build.Options) (*source.RemoteReader, error) {
+	cacheDir := opts.CacheDir
+	if cacheDir == "" {
+		dir, err := source.DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		cacheDir = dir
+	}
+	rr := source.NewRemoteReader(cacheDir, manifest.Sources)
+	if err := rr.FetchAll(ctx); err != nil {
+		return nil, fmt.Errorf("fetching manifest sources: %w", err)
+	}
+	return rr, nil
+}
+
+// getGitSourceReader returns a reader of the files at the source ref of the
+// options. It fails if there are changes not committed in the directory,
+// unless dirty trees are allowed.
+func getGitSourceReader(dir string, opts *build.Options) (*source.GitReader, error) {
+	gr, err := source.NewGitReader(dir, opts.SourceRef)
+	if err != nil {
+		return nil, fmt.Errorf("reading sources from git: %w", err)
+	}
+	dirty, err := gr.Dirty()
+	if err != nil {
+		return nil, fmt.Errorf("checking git tree: %w", err)
+	}
+	if dirty {
+		if !opts.AllowDirty {
+			return nil, fmt.Errorf("%s has changes not committed, use --allow-dirty to build from %s anyway", dir, opts.SourceRef)
+		}
+		logrus.Warnf("%s has changes not committed, they are not packaged", dir)
+	}
+	logrus.Infof("Reading sources from %s (%s)", opts.SourceRef, gr.Commit())
+	return gr, nil
+}
+
+// getVersionReader returns the version.Reader used when the version is not
+// set in the options. It reads the file defined in the manifest versionFrom
+// or, if there is none, the tags of the git repository of the manifest.
+func getVersionReader(manifest *spec.Manifest, manifestPath string) version.Reader {
+	manifestDir := filepath.Dir(manifestPath)
+	if vf := manifest.VersionFrom; vf != nil && vf.File != "" {
+		path := vf.File
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(manifestDir, path)
+		}
+		return version.NewFileReader(path, vf.Format, vf.Key)
 	}
-	return nil, fmt.Errorf("filesystem not usable, need to implement io.StatFS")
+	return version.NewGitReader(manifestDir)
 }
 
 // Returns a package worker for the specified type
@@ -0,0 +1,72 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func TestGetSourceReaderOutputs(t *testing.T) {
+	t.Parallel()
+	// The manifest directory mixes the output of a build step with
+	// committed files in the same directory
+	manifestDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(manifestDir, "bin"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(manifestDir, "bin", "app"), []byte("app"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(manifestDir, "bin", "script.sh"), []byte("script"), os.FileMode(0o755)))
+
+	// A separate source directory with its own copy of the directory
+	sourceDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sourceDir, "bin"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(sourceDir, "bin", "tool"), []byte("tool"), os.FileMode(0o755)))
+
+	manifest := &spec.Manifest{
+		Component: spec.Component{Name: "test"},
+		Build:     []*spec.BuildStep{{Command: "true", Outputs: []string{"bin/app"}}},
+	}
+
+	for _, tc := range []struct {
+		name      string
+		sourceDir string
+		listed    []*spec.File
+	}{
+		{
+			name:   "manifest-directory",
+			listed: []*spec.File{{Source: "bin/app"}, {Source: "bin/script.sh"}},
+		},
+		{
+			name:      "same-source-directory",
+			sourceDir: manifestDir,
+			listed:    []*spec.File{{Source: "bin/app"}, {Source: "bin/script.sh"}},
+		},
+		{
+			// The output is found as a file, the directory is listed
+			// from the source directory
+			name:      "other-source-directory",
+			sourceDir: sourceDir,
+			listed:    []*spec.File{{Source: "bin/tool"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			r, err := getSourceReader(ctx, manifest, &build.Options{SourceDir: tc.sourceDir}, manifestDir)
+			require.NoError(t, err)
+
+			files, err := r.ListDirFiles(ctx, "bin")
+			require.NoError(t, err)
+			require.Equal(t, tc.listed, files)
+
+			_, err = r.Stat(ctx, &spec.File{Source: "bin/app"})
+			require.NoError(t, err)
+		})
+	}
+}
@@ -5,17 +5,24 @@ package builder
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
+	"strings"
 
+	"github.com/sirupsen/logrus"
 	"github.com/uservers/baggr/pkg/build"
 	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/version"
 )
 
 type EngineImplementation interface {
-	ParseManifest(context.Context, string) (*spec.Manifest, error)
-	CheckSourceFiles(context.Context, *spec.Manifest) error
+	ParseManifest(context.Context, string, map[string]string) (*spec.Manifest, error)
+	CheckSourceFiles(context.Context, *build.Options, *spec.Manifest) error
 	EnsureVersion(context.Context, *build.Options) error
+	EnsureRelease(context.Context, *build.Options, *spec.Manifest) error
+	RunBuildSteps(context.Context, *build.Options, *spec.Manifest) error
 }
 
 type defaultEngineImplementation struct{}
@@ -38,46 +45,90 @@ func (di *defaultEngineImplementation) EnsureVersion(ctx context.Context, opts *
 
 	lastVer, err := opts.VersionReader.GetLastVersion(ctx)
 	if err != nil {
-		return fmt.Errorf("reading last project version")
+		return fmt.Errorf("reading last project version: %w", err)
 	}
 	ver, err := opts.VersionReader.ComputeNextVersion(ctx, lastVer)
 	if err != nil {
 		return fmt.Errorf("computing next version: %w", err)
 	}
 
+	// The release set in the options still applies to computed versions
+	if opts.Version != nil && opts.Version.Release != "" {
+		ver.Release = opts.Version.Release
+	}
+	logrus.Infof("Computed version %s (last version %s)", ver.String, lastVer.String)
+
 	if bc, ok := buildContext.(*build.Context); ok {
 		bc.Version = ver
 	}
 	return nil
 }
 
-// ParseManifest parses the yaml file and returns a new manifest object
-func (di *defaultEngineImplementation) ParseManifest(_ context.Context, path string) (*spec.Manifest, error) {
-	manifest, err := spec.NewManifestFromFile(path)
+// EnsureRelease sets the release of the version to the one following the
+// last release of the package found in the ReleaseFrom directory
+func (di *defaultEngineImplementation) EnsureRelease(
+	ctx context.Context, opts *build.Options, manifest *spec.Manifest,
+) error {
+	if opts.ReleaseFrom == "" {
+		return nil
+	}
+
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("resolving version: %w", err)
+	}
+
+	release, err := version.NewReleaseResolver(opts.ReleaseFrom).NextRelease(manifest.Name, ver.String)
+	if err != nil {
+		return fmt.Errorf("computing next release: %w", err)
+	}
+	logrus.Infof("Next release of %s %s is %s", manifest.Name, ver.String, release)
+	ver.Release = release
+	return nil
+}
+
+// ParseManifest parses the yaml file and returns a new manifest object. The
+// vars override the values of the manifest variables.
+func (di *defaultEngineImplementation) ParseManifest(_ context.Context, path string, vars map[string]string) (*spec.Manifest, error) {
+	manifest, err := spec.NewManifestFromFileWithVars(path, vars)
 	if err != nil {
 		return nil, fmt.Errorf("parsing manifest file: %w", err)
 	}
 	return manifest, nil
 }
 
-// CheckSourceFiles
-func (di *defaultEngineImplementation) CheckSourceFiles(_ context.Context, manifest *spec.Manifest) error {
-	// TODO: Extract cwd from context
-	// TODO use source reader
+// CheckSourceFiles checks that the sources of the files of all the
+// components exist in the source reader, the error lists the missing ones.
+// Directories, ghosts and links are not read from the sources and globs
+// are checked by their base directory.
+func (di *defaultEngineImplementation) CheckSourceFiles(
+	ctx context.Context, opts *build.Options, manifest *spec.Manifest,
+) error {
+	if opts.SourceReader == nil {
+		return fmt.Errorf("unable to check source files, no source reader defined")
+	}
+
 	notFound := []string{}
-	for _, file := range manifest.Files {
-		if _, err := os.Stat(file.Source); err != nil {
-			if err != os.ErrNotExist {
-				return fmt.Errorf("error checking for file: %w", err)
+	for _, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		for _, f := range c.Files {
+			if f.IsDir() || f.IsLink() || f.Type == spec.FileTypeGhost {
+				continue
+			}
+			sf := f
+			if f.IsGlob() {
+				sf = &spec.File{Source: f.GlobBase()}
+			}
+			if _, err := opts.SourceReader.Stat(ctx, sf); err != nil {
+				if !errors.Is(err, fs.ErrNotExist) {
+					return fmt.Errorf("checking source file %s: %w", f.Source, err)
+				}
+				notFound = append(notFound, f.Source)
 			}
-			notFound = append(notFound, file.Source)
 		}
 	}
 
-	// TODO(puerco): Components
-
 	if len(notFound) > 0 {
-		return fmt.Errorf("source files not found: %v", notFound)
+		return fmt.Errorf("source files not found: %s", strings.Join(notFound, ", "))
 	}
 	return nil
 }
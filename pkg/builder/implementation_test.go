@@ -0,0 +1,103 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func TestCheckSourceFiles(t *testing.T) {
+	t.Parallel()
+	srcDir := t.TempDir()
+	rootDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcDir, "bin"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "bin", "test"), []byte("#!/bin/sh\n"), os.FileMode(0o644)))
+	require.NoError(t, os.MkdirAll(filepath.Join(rootDir, "share", "locale"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(rootDir, "share", "locale", "es.mo"), []byte("hola"), os.FileMode(0o644)))
+
+	opts := &build.Options{SourceReader: source.NewMultiReader(
+		source.Root{Name: "source root", Reader: source.NewFilesystemReader(source.DirFS(rootDir))},
+		source.Root{Name: "source directory", Reader: source.NewFilesystemReader(source.DirFS(srcDir))},
+	)}
+	di := &defaultEngineImplementation{}
+
+	for _, tc := range []struct {
+		name     string
+		manifest *spec.Manifest
+		missing  string
+	}{
+		{
+			name: "found",
+			manifest: &spec.Manifest{
+				Component: spec.Component{Name: "test", Files: []*spec.File{
+					{Source: "bin/test", Destination: "/usr/bin/test"},
+					{Source: "bin", Destination: "/usr/bin"},
+					{Source: "share/**/*.mo", Destination: "/usr/share"},
+				}},
+			},
+		},
+		{
+			name: "not-read-from-sources",
+			manifest: &spec.Manifest{
+				Component: spec.Component{Name: "test", Files: []*spec.File{
+					{Source: spec.DirSource, Destination: "/var/lib/test"},
+					{Destination: "/var/log/test.log", Type: spec.FileTypeGhost},
+					{Destination: "/usr/bin/test-link", Type: spec.FileTypeSymlink, Target: "test"},
+					{Destination: "/usr/bin/test2", Type: spec.FileTypeHardlink, Target: "/usr/bin/test"},
+				}},
+			},
+		},
+		{
+			name: "missing-file",
+			manifest: &spec.Manifest{
+				Component: spec.Component{Name: "test", Files: []*spec.File{
+					{Source: "bin/test", Destination: "/usr/bin/test"},
+					{Source: "bin/missing", Destination: "/usr/bin/missing"},
+				}},
+			},
+			missing: "bin/missing",
+		},
+		{
+			name: "missing-glob",
+			manifest: &spec.Manifest{
+				Component: spec.Component{Name: "test", Files: []*spec.File{
+					{Source: "docs/*.html", Destination: "/usr/share/doc"},
+				}},
+			},
+			missing: "docs/*.html",
+		},
+		{
+			name: "missing-in-component",
+			manifest: &spec.Manifest{
+				Component: spec.Component{Name: "test"},
+				Components: []*spec.Component{
+					{Name: "docs", Files: []*spec.File{{Source: "docs", Destination: "/usr/share/doc"}}},
+				},
+			},
+			missing: "docs",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := di.CheckSourceFiles(context.Background(), opts, tc.manifest)
+			if tc.missing == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "source files not found: "+tc.missing)
+		})
+	}
+
+	// A source reader is required
+	require.Error(t, di.CheckSourceFiles(context.Background(), &build.Options{}, &spec.Manifest{}))
+}
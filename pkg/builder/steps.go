@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"sigs.k8s.io/release-utils/command"
+)
+
+// RunBuildSteps runs the build steps of the manifest in order. The output
+// of the commands is logged at debug level and returned in the error when
+// a step fails.
+func (di *defaultEngineImplementation) RunBuildSteps(
+	ctx context.Context, opts *build.Options, manifest *spec.Manifest,
+) error {
+	if len(manifest.Build) == 0 {
+		return nil
+	}
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("resolving version: %w", err)
+	}
+	manifestDir := staging.ManifestDir(ctx)
+	env := []string{
+		"BAGGR_NAME=" + manifest.Name,
+		"BAGGR_VERSION=" + ver.String,
+		"BAGGR_RELEASE=" + ver.Release,
+		"BAGGR_MANIFEST_DIR=" + manifestDir,
+	}
+
+	for i, step := range manifest.Build {
+		logrus.Infof("Running build step %d/%d: %s", i+1, len(manifest.Build), step)
+		if err := runBuildStep(manifestDir, step, env); err != nil {
+			return fmt.Errorf("build step %q: %w", step.String(), err)
+		}
+	}
+	return nil
+}
+
+// runBuildStep runs the command of a step and checks that it produced its
+// outputs
+func runBuildStep(manifestDir string, step *spec.BuildStep, env []string) error {
+	dir := manifestDir
+	if step.Dir != "" {
+		dir = step.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(manifestDir, dir)
+		}
+	}
+
+	// Variables are sorted to run the commands with the same environment
+	stepEnv := slices.Clone(env)
+	keys := []string{}
+	for k := range step.Env {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		stepEnv = append(stepEnv, k+"="+step.Env[k])
+	}
+
+	status, err := command.NewWithWorkDir(dir, spec.DefaultInterpreter, "-ec", step.Command).Env(stepEnv...).RunSilent()
+	if err != nil {
+		return fmt.Errorf("executing command: %w", err)
+	}
+	log := stepLog(status.Output(), status.Error())
+	for _, line := range strings.Split(log, "\n") {
+		if line != "" {
+			logrus.Debugf("[%s] %s", step, line)
+		}
+	}
+	if !status.Success() {
+		return fmt.Errorf("command exited with status %d:\n%s", status.ExitCode(), log)
+	}
+
+	for _, o := range step.Outputs {
+		if _, err := os.Stat(filepath.Join(manifestDir, filepath.FromSlash(o))); err != nil {
+			return fmt.Errorf("checking output %s: %w", o, err)
+		}
+	}
+	return nil
+}
+
+// stepLog joins the standard output and error of a step
+func stepLog(stdout, stderr string) string {
+	stdout = strings.TrimRight(stdout, "\n")
+	stderr = strings.TrimRight(stderr, "\n")
+	if stdout != "" && stderr != "" {
+		return stdout + "\n" + stderr
+	}
+	return stdout + stderr
+}
+
+// buildOutputs returns the outputs declared in the build steps
+func buildOutputs(manifest *spec.Manifest) []string {
+	outputs := []string{}
+	for _, step := range manifest.Build {
+		outputs = append(outputs, step.Outputs...)
+	}
+	return outputs
+}
@@ -0,0 +1,57 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+func TestRunBuildSteps(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "src"), os.FileMode(0o755)))
+	ctx := context.WithValue(context.Background(), build.ContextKey{}, &build.Context{ManifestDir: dir})
+	opts := &build.Options{Version: &version.Spec{String: "1.2.3", Release: "1"}}
+	di := &defaultEngineImplementation{}
+
+	manifest := &spec.Manifest{
+		Component: spec.Component{Name: "test"},
+		Build: []*spec.BuildStep{
+			{
+				Name:    "compile",
+				Command: "mkdir -p ../bin\necho \"$BAGGR_NAME $BAGGR_VERSION-$BAGGR_RELEASE $GOOS\" > ../bin/server",
+				Dir:     "src",
+				Env:     map[string]string{"GOOS": "linux"},
+				Outputs: []string{"bin/server"},
+			},
+			{Command: "cp bin/server bin/server.bak", Outputs: []string{"bin/server.bak"}},
+		},
+	}
+	require.NoError(t, di.RunBuildSteps(ctx, opts, manifest))
+	data, err := os.ReadFile(filepath.Join(dir, "bin", "server.bak"))
+	require.NoError(t, err)
+	require.Equal(t, "test 1.2.3-1 linux\n", string(data))
+
+	// Failing commands return their output
+	manifest.Build = []*spec.BuildStep{{Command: "echo compiling\necho broken >&2\nexit 3\necho not run"}}
+	err = di.RunBuildSteps(ctx, opts, manifest)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "status 3")
+	require.Contains(t, err.Error(), "compiling\nbroken")
+	require.NotContains(t, err.Error(), "not run")
+
+	// Steps must produce their outputs
+	manifest.Build = []*spec.BuildStep{{Name: "lazy", Command: "true", Outputs: []string{"bin/missing"}}}
+	err = di.RunBuildSteps(ctx, opts, manifest)
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.Contains(t, err.Error(), `"lazy"`)
+}
@@ -0,0 +1,49 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package deb
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+const arMagic = "!<arch>\n"
+
+// arWriter writes the common ar archive format used as the container of
+// debian packages
+type arWriter struct {
+	w io.Writer
+}
+
+// newArWriter creates an ar writer and writes the global archive header
+func newArWriter(w io.Writer) (*arWriter, error) {
+	if _, err := io.WriteString(w, arMagic); err != nil {
+		return nil, fmt.Errorf("writing ar magic: %w", err)
+	}
+	return &arWriter{w: w}, nil
+}
+
+// WriteFile adds a file of size bytes read from r to the archive
+func (aw *arWriter) WriteFile(name string, modTime time.Time, size int64, r io.Reader) error {
+	if len(name) > 16 {
+		return fmt.Errorf("ar member name %q is too long", name)
+	}
+	if _, err := fmt.Fprintf(
+		aw.w, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, modTime.Unix(), 0, 0, 0o100644, size,
+	); err != nil {
+		return fmt.Errorf("writing ar header: %w", err)
+	}
+	if _, err := io.CopyN(aw.w, r, size); err != nil {
+		return fmt.Errorf("writing ar member data: %w", err)
+	}
+
+	// Members are aligned to 2 bytes
+	if size%2 != 0 {
+		if _, err := aw.w.Write([]byte{'\n'}); err != nil {
+			return fmt.Errorf("padding ar member: %w", err)
+		}
+	}
+	return nil
+}
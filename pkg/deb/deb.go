@@ -0,0 +1,53 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package deb is a baggr implementation that builds debian packages
+package deb
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// DefaultMaintainer is written to the control file of packages built from
+// manifests that don't define a maintainer.
+const DefaultMaintainer = "baggr <baggr@localhost>"
+
+func New() *Worker {
+	return &Worker{
+		implementation: &defaultImplementation{},
+	}
+}
+
+type Worker struct {
+	implementation Implementation
+}
+
+// BuildPackages takes a manifest and builds a .deb for the main component
+// and one for each of its subcomponents.
+func (w *Worker) BuildPackages(ctx context.Context, manifest *spec.Manifest, opts *build.Options) (build.Result, error) {
+	var results build.Result
+	// Create a temp directory to stage the package files
+	tmp, err := os.MkdirTemp("", "baggr-debroot-*")
+	if err != nil {
+		return results, fmt.Errorf("creating temporary staging directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	sourceWriter := source.NewDirWriter(tmp)
+
+	if err := w.implementation.CopySourceFiles(ctx, opts, sourceWriter, manifest); err != nil {
+		return results, fmt.Errorf("copying package files: %w", err)
+	}
+
+	results, err = w.implementation.BuildDebs(ctx, opts, sourceWriter, manifest)
+	if err != nil {
+		return results, fmt.Errorf("packaging debs: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,394 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5" //nolint:gosec // md5sums is the checksum file dpkg expects
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+const (
+	debianBinary = "2.0\n"
+	architecture = "all"
+)
+
+type Implementation interface {
+	CopySourceFiles(context.Context, *build.Options, source.Writer, *spec.Manifest) error
+	BuildDebs(context.Context, *build.Options, source.Writer, *spec.Manifest) (build.Result, error)
+}
+
+type defaultImplementation struct{}
+
+// control holds the fields written to the debian control file
+type control struct {
+	Package       string
+	Version       string
+	Maintainer    string
+	InstalledSize int64
+	Depends       []string
+	Recommends    []string
+	Suggests      []string
+	Enhances      []string
+	Conflicts     []string
+	Provides      []string
+	Replaces      []string
+	Homepage      string
+	Summary       string
+	Description   string
+}
+
+// String renders the control file
+func (c *control) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Package: %s\n", c.Package)
+	fmt.Fprintf(&b, "Version: %s\n", c.Version)
+	fmt.Fprintf(&b, "Architecture: %s\n", architecture)
+	fmt.Fprintf(&b, "Maintainer: %s\n", c.Maintainer)
+	fmt.Fprintf(&b, "Installed-Size: %d\n", c.InstalledSize)
+	for _, field := range []struct {
+		name    string
+		entries []string
+	}{
+		{"Depends", c.Depends},
+		{"Recommends", c.Recommends},
+		{"Suggests", c.Suggests},
+		{"Enhances", c.Enhances},
+		{"Conflicts", c.Conflicts},
+		{"Provides", c.Provides},
+		{"Replaces", c.Replaces},
+	} {
+		if len(field.entries) > 0 {
+			fmt.Fprintf(&b, "%s: %s\n", field.name, strings.Join(field.entries, ", "))
+		}
+	}
+	b.WriteString("Section: misc\n")
+	b.WriteString("Priority: optional\n")
+	if c.Homepage != "" {
+		fmt.Fprintf(&b, "Homepage: %s\n", c.Homepage)
+	}
+
+	// The first line of the description is the synopsis, the rest
+	// is indented by one space and empty lines are replaced by a dot.
+	summary := c.Summary
+	if summary == "" {
+		summary = c.Package
+	}
+	fmt.Fprintf(&b, "Description: %s\n", strings.TrimSpace(summary))
+	if desc := strings.TrimSpace(c.Description); desc != "" {
+		for _, l := range strings.Split(desc, "\n") {
+			if strings.TrimSpace(l) == "" {
+				l = "."
+			}
+			fmt.Fprintf(&b, " %s\n", l)
+		}
+	}
+	return b.String()
+}
+
+// CopySourceFiles copies the files from the source reader using the source writer
+func (di *defaultImplementation) CopySourceFiles(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) error {
+	return staging.CopyFiles(ctx, opts, sourceWriter, manifest)
+}
+
+// BuildDebs writes a debian package for the main component and one for
+// each of the subcomponents that has files. Subcomponents are named after
+// the main package, eg "name-docs".
+func (di *defaultImplementation) BuildDebs(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) (results build.Result, err error) {
+	results = build.Result{Artifacts: []build.Artifact{}}
+	if len(manifest.Files) == 0 {
+		return results, fmt.Errorf("unable to build deb, no files defined in top level project")
+	}
+
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return results, fmt.Errorf("resolving package version: %w", err)
+	}
+	debVersion := version.TranslateDeb(ver.String)
+	if ver.Release != "" {
+		debVersion += "-" + ver.Release
+	}
+
+	maintainer := manifest.Maintainer
+	if maintainer == "" {
+		maintainer = DefaultMaintainer
+	}
+
+	for i, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		name := manifest.Name
+		if i > 0 {
+			if len(c.Files) == 0 {
+				logrus.Infof("Component %s not packaged because it does not provide any files", c.Name)
+				continue
+			}
+			name = fmt.Sprintf("%s-%s", manifest.Name, c.Name)
+		}
+		name = strings.ToLower(name)
+
+		entries, err := staging.Collect(sourceWriter.Path(), c)
+		if err != nil {
+			return results, fmt.Errorf("reading files of %s: %w", name, err)
+		}
+		entries = staging.WithoutGhosts(entries)
+
+		// NoDeps has no equivalent here: dependencies are never computed
+		// automatically, so only the ones in the manifest are written.
+		if c.NoDeps {
+			logrus.Warnf("Package %s: deb packages don't compute dependencies, nodeps has no effect", name)
+		}
+
+		// Obsoleted packages are replaced and conflict with this one, the
+		// closest match to supplements is the reverse weak Enhances field.
+		ctrl := &control{
+			Package:     name,
+			Version:     debVersion,
+			Maintainer:  maintainer,
+			Depends:     depends(c.Requires),
+			Recommends:  depends(c.Recommends),
+			Suggests:    depends(c.Suggests),
+			Enhances:    depends(c.Supplements),
+			Conflicts:   depends(slices.Concat(c.Conflicts, c.Obsoletes)),
+			Provides:    depends(c.Provides),
+			Replaces:    depends(c.Obsoletes),
+			Homepage:    manifest.URL,
+			Summary:     c.Summary,
+			Description: c.Description,
+		}
+
+		debPath := filepath.Join(opts.OutputDir, fmt.Sprintf("%s_%s_%s.deb", name, debVersion, architecture))
+		if err := writeDeb(debPath, ctrl, entries, maintainerScripts(name, &c.Scripts)); err != nil {
+			return results, fmt.Errorf("writing %s: %w", name, err)
+		}
+		logrus.Infof("Wrote: %s", debPath)
+		results.Artifacts = append(results.Artifacts, build.NewFileArtifact(debPath))
+	}
+	return results, nil
+}
+
+// writeDeb writes the debian package to path
+func writeDeb(debPath string, ctrl *control, entries []*staging.Entry, scripts []controlFile) error {
+	dataFile, err := os.CreateTemp("", "baggr-deb-data-*")
+	if err != nil {
+		return fmt.Errorf("creating data file: %w", err)
+	}
+	defer func() {
+		dataFile.Close()
+		os.Remove(dataFile.Name())
+	}()
+
+	if err := writeData(dataFile, entries); err != nil {
+		return fmt.Errorf("writing data archive: %w", err)
+	}
+	dataInfo, err := dataFile.Stat()
+	if err != nil {
+		return fmt.Errorf("reading data archive size: %w", err)
+	}
+
+	var installedSize int64
+	for _, e := range entries {
+		if !e.IsDir() {
+			installedSize += e.Size
+		}
+	}
+	ctrl.InstalledSize = (installedSize + 1023) / 1024
+
+	sums, err := md5sums(entries)
+	if err != nil {
+		return fmt.Errorf("computing md5sums: %w", err)
+	}
+
+	files := []controlFile{
+		{Name: "control", Mode: 0o644, Content: ctrl.String()},
+		{Name: "md5sums", Mode: 0o644, Content: sums},
+	}
+	if conf := conffiles(entries); conf != "" {
+		files = append(files, controlFile{Name: "conffiles", Mode: 0o644, Content: conf})
+	}
+	controlData, err := buildControlArchive(append(files, scripts...))
+	if err != nil {
+		return fmt.Errorf("writing control archive: %w", err)
+	}
+
+	f, err := os.Create(debPath)
+	if err != nil {
+		return fmt.Errorf("creating package file: %w", err)
+	}
+	defer f.Close()
+
+	now := time.Now()
+	aw, err := newArWriter(f)
+	if err != nil {
+		return err
+	}
+	if err := aw.WriteFile("debian-binary", now, int64(len(debianBinary)), strings.NewReader(debianBinary)); err != nil {
+		return err
+	}
+	if err := aw.WriteFile("control.tar.gz", now, int64(len(controlData)), bytes.NewReader(controlData)); err != nil {
+		return err
+	}
+	if _, err := dataFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding data archive: %w", err)
+	}
+	if err := aw.WriteFile("data.tar.gz", now, dataInfo.Size(), dataFile); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeData writes the compressed data archive with the package files
+func writeData(w io.Writer, entries []*staging.Entry) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	// dpkg expects the archive to list every directory, starting at ./
+	if err := tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir, Name: "./", Mode: 0o755, Uname: staging.DefaultOwner, Gname: staging.DefaultOwner,
+		ModTime: time.Now(), Format: tar.FormatGNU,
+	}); err != nil {
+		return fmt.Errorf("writing root directory: %w", err)
+	}
+	if err := staging.WriteTar(tw, "./", staging.WithParents(entries)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar stream: %w", err)
+	}
+	return gz.Close()
+}
+
+// controlFile is a file in the control archive
+type controlFile struct {
+	Name    string
+	Mode    int64
+	Content string
+}
+
+// buildControlArchive returns the compressed control archive
+func buildControlArchive(files []controlFile) ([]byte, error) {
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	tw := tar.NewWriter(gz)
+	now := time.Now()
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg, Name: "./" + f.Name, Mode: f.Mode, Size: int64(len(f.Content)),
+			Uname: staging.DefaultOwner, Gname: staging.DefaultOwner, ModTime: now, Format: tar.FormatGNU,
+		}); err != nil {
+			return nil, fmt.Errorf("writing %s header: %w", f.Name, err)
+		}
+		if _, err := io.WriteString(tw, f.Content); err != nil {
+			return nil, fmt.Errorf("writing %s: %w", f.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("closing tar stream: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("closing gzip stream: %w", err)
+	}
+	return b.Bytes(), nil
+}
+
+// maintainerScripts returns the control files of the component scripts.
+// The install and uninstall scripts map to the dpkg maintainer scripts,
+// which also run on upgrades like their rpm counterparts. dpkg has no
+// transaction hooks so pretrans and posttrans are not packaged.
+func maintainerScripts(name string, s *spec.Scripts) []controlFile {
+	if s.PreTrans.Defined() || s.PostTrans.Defined() {
+		logrus.Warnf("Package %s: deb packages don't support pretrans and posttrans scripts, skipping them", name)
+	}
+
+	files := []controlFile{}
+	for _, ms := range []struct {
+		name   string
+		script *spec.Script
+	}{
+		{"preinst", &s.PreInstall},
+		{"postinst", &s.PostInstall},
+		{"prerm", &s.PreUninstall},
+		{"postrm", &s.PostUninstall},
+	} {
+		if ms.script.Defined() {
+			files = append(files, controlFile{Name: ms.name, Mode: 0o755, Content: ms.script.Executable()})
+		}
+	}
+	return files
+}
+
+// conffiles returns the contents of the conffiles control file, listing
+// the regular files marked as config in the manifest. dpkg always keeps
+// the changes made to conffiles, as rpm does with noreplace.
+func conffiles(entries []*staging.Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		if e.Is(spec.FileTypeConfig) && e.Mode.IsRegular() {
+			b.WriteString(e.Path + "\n")
+		}
+	}
+	return b.String()
+}
+
+// md5sums returns the contents of the md5sums control file
+func md5sums(entries []*staging.Entry) (string, error) {
+	var b strings.Builder
+	for _, e := range entries {
+		if !e.Mode.IsRegular() {
+			continue
+		}
+		f, err := e.Open()
+		if err != nil {
+			return "", err
+		}
+		h := md5.New() //nolint:gosec // required by dpkg
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", fmt.Errorf("hashing %s: %w", e.Path, err)
+		}
+		fmt.Fprintf(&b, "%s  %s\n", hex.EncodeToString(h.Sum(nil)), strings.TrimPrefix(e.Path, "/"))
+	}
+	return b.String(), nil
+}
+
+// depends translates the relations in the manifest to debian
+// relationships, eg "perl >= 5.0" becomes "perl (>= 5.0)"
+func depends(rels spec.Relations) []string {
+	res := []string{}
+	for _, r := range rels {
+		op := r.Operator
+		switch op {
+		case "":
+			res = append(res, r.Name)
+			continue
+		case spec.OpLess:
+			op = "<<"
+		case spec.OpGreater:
+			op = ">>"
+		}
+		res = append(res, fmt.Sprintf("%s (%s %s)", r.Name, op, r.Version))
+	}
+	return res
+}
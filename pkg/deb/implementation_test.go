@@ -0,0 +1,139 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package deb
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging/stagingtest"
+)
+
+// readAr returns the members of an ar archive
+func readAr(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(data), arMagic))
+
+	res := map[string][]byte{}
+	data = data[len(arMagic):]
+	for len(data) > 0 {
+		name := strings.TrimSpace(string(data[:16]))
+		size, err := strconv.Atoi(strings.TrimSpace(string(data[48:58])))
+		require.NoError(t, err)
+		res[name] = data[60 : 60+size]
+		data = data[60+size+size%2:]
+	}
+	return res
+}
+
+// readTarGz returns the contents of the files in a compressed tarball
+func readTarGz(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	res := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			res[hdr.Name] = "<dir>"
+			continue
+		case tar.TypeSymlink:
+			res[hdr.Name] = "<symlink to " + hdr.Linkname + ">"
+			continue
+		case tar.TypeLink:
+			res[hdr.Name] = "<hardlink to " + hdr.Linkname + ">"
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		res[hdr.Name] = string(content)
+	}
+	return res
+}
+
+func TestBuildDebs(t *testing.T) {
+	t.Parallel()
+	ctx := stagingtest.Context("1.0.0", "1")
+	swTemp := stagingtest.Dir(t, map[string]string{"etc/test.conf": "debug=0\n"})
+	require.NoError(t, os.Symlink("test", filepath.Join(swTemp, "usr", "bin", "test-link")))
+	require.NoError(t, os.Link(filepath.Join(swTemp, "usr", "bin", "test"), filepath.Join(swTemp, "usr", "bin", "a-test")))
+
+	man := stagingtest.Manifest(
+		&spec.File{Source: "etc/test.conf", Destination: "/etc/test.conf", Type: spec.FileTypeConfig, NoReplace: true},
+		&spec.File{Destination: "/var/log/test.log", Type: spec.FileTypeGhost},
+		&spec.File{Destination: "/usr/bin/test-link", Type: spec.FileTypeSymlink, Target: "test"},
+		&spec.File{Destination: "/usr/bin/a-test", Type: spec.FileTypeHardlink, Target: "/usr/bin/test"},
+	)
+	man.Name = "Test"
+	man.Description = "First line\n\nSecond paragraph"
+	man.Files[0].UID = "daemon"
+	man.Requires = spec.Relations{{Name: "bash", Operator: ">=", Version: "4.0"}, {Name: "coreutils"}}
+	man.Obsoletes = spec.Relations{{Name: "old-test"}}
+	man.Suggests = spec.Relations{{Name: "test-docs"}}
+	man.Scripts = spec.Scripts{
+		PostInstall: spec.Script{Inline: "systemctl daemon-reload"},
+		PreTrans:    spec.Script{Inline: "true"},
+	}
+	man.Components = []*spec.Component{{Name: "empty"}}
+
+	di := defaultImplementation{}
+	res, err := di.BuildDebs(ctx, &build.Options{OutputDir: t.TempDir()}, source.NewDirWriter(swTemp), man)
+	require.NoError(t, err)
+	require.Len(t, res.Artifacts, 1)
+	require.Equal(t, "test_1.0.0-1_all.deb", filepath.Base(res.Artifacts[0].Path()))
+
+	members := readAr(t, res.Artifacts[0].Path())
+	require.Equal(t, debianBinary, string(members["debian-binary"]))
+
+	ctrl := readTarGz(t, members["control.tar.gz"])
+	require.Contains(t, ctrl["./control"], "Package: test\n")
+	require.Contains(t, ctrl["./control"], "Depends: bash (>= 4.0), coreutils\nSuggests: test-docs\n")
+	require.Contains(t, ctrl["./control"], "Conflicts: old-test\nReplaces: old-test\n")
+	require.Contains(t, ctrl["./control"], "Description: Test project\n First line\n .\n Second paragraph\n")
+	require.Contains(t, ctrl["./md5sums"], "  usr/bin/test\n")
+	require.Equal(t, "#!/bin/sh\nsystemctl daemon-reload\n", ctrl["./postinst"])
+	require.NotContains(t, ctrl, "./preinst")
+	require.Equal(t, "/etc/test.conf\n", ctrl["./conffiles"])
+
+	data := readTarGz(t, members["data.tar.gz"])
+	require.Equal(t, "<dir>", data["./usr/bin/"])
+	require.Equal(t, "#!/bin/sh\n", data["./usr/bin/a-test"])
+	require.Equal(t, "<hardlink to ./usr/bin/a-test>", data["./usr/bin/test"])
+	require.Equal(t, "<symlink to test>", data["./usr/bin/test-link"])
+	require.Equal(t, "debug=0\n", data["./etc/test.conf"])
+	require.NotContains(t, data, "./var/log/test.log")
+}
+
+func TestDepends(t *testing.T) {
+	t.Parallel()
+	require.Equal(t,
+		[]string{"bash", "perl (>= 5.0)", "libc (<< 2)", "foo (>> 1)", "bar (= 1.0)"},
+		depends(spec.Relations{
+			{Name: "bash"},
+			{Name: "perl", Operator: ">=", Version: "5.0"},
+			{Name: "libc", Operator: "<", Version: "2"},
+			{Name: "foo", Operator: ">", Version: "1"},
+			{Name: "bar", Operator: "=", Version: "1.0"},
+		}),
+	)
+}
@@ -0,0 +1,349 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+)
+
+const (
+	mediaTypeIndex    = "application/vnd.oci.image.index.v1+json"
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar+gzip"
+
+	annotationRefName = "org.opencontainers.image.ref.name"
+	annotationTitle   = "org.opencontainers.image.title"
+	annotationVersion = "org.opencontainers.image.version"
+
+	layoutVersion = "1.0.0"
+)
+
+type Implementation interface {
+	CopySourceFiles(context.Context, *build.Options, source.Writer, *spec.Manifest) error
+	BuildImage(context.Context, *build.Options, source.Writer, *spec.Manifest, Format) (build.Result, error)
+}
+
+type defaultImplementation struct{}
+
+// descriptor points to a blob in the image layout
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type index struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Manifests     []descriptor `json:"manifests"`
+}
+
+type imageManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// imageConfig is the image configuration. The images don't have a base
+// so the only runtime setting we write are the labels.
+type imageConfig struct {
+	Created      time.Time `json:"created"`
+	Architecture string    `json:"architecture"`
+	OS           string    `json:"os"`
+	Config       struct {
+		Labels map[string]string `json:"Labels,omitempty"`
+	} `json:"config"`
+	RootFS struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	History []history `json:"history"`
+}
+
+type history struct {
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+	Comment   string    `json:"comment,omitempty"`
+}
+
+// CopySourceFiles copies the files from the source reader using the source writer
+func (di *defaultImplementation) CopySourceFiles(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) error {
+	return staging.CopyFiles(ctx, opts, sourceWriter, manifest)
+}
+
+// BuildImage writes the image layout with a layer for the main component
+// and one for each subcomponent that has files. The layout is written to
+// a directory or, when the format is FormatArchive, to a tarball.
+func (di *defaultImplementation) BuildImage(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest, format Format,
+) (results build.Result, err error) {
+	results = build.Result{Artifacts: []build.Artifact{}}
+
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return results, fmt.Errorf("resolving version: %w", err)
+	}
+
+	baseName := fmt.Sprintf("%s-%s", manifest.Name, ver.String)
+	layoutDir := filepath.Join(opts.OutputDir, baseName+"-oci")
+	if format == FormatArchive {
+		tmp, err := os.MkdirTemp("", "baggr-oci-*")
+		if err != nil {
+			return results, fmt.Errorf("creating temporary layout directory: %w", err)
+		}
+		defer os.RemoveAll(tmp)
+		layoutDir = tmp
+	} else if err := os.RemoveAll(layoutDir); err != nil {
+		return results, fmt.Errorf("removing previous image layout: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(layoutDir, "blobs", "sha256"), os.FileMode(0o755)); err != nil {
+		return results, fmt.Errorf("creating blobs directory: %w", err)
+	}
+
+	created := time.Now().UTC()
+	config := imageConfig{
+		Created: created,
+		// The files are architecture independent but the config requires one,
+		// we default to the platform baggr runs on so the image loads locally.
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		History:      []history{},
+	}
+	config.Config.Labels = map[string]string{
+		annotationTitle:   manifest.Name,
+		annotationVersion: ver.String,
+	}
+	config.RootFS.Type = "layers"
+	config.RootFS.DiffIDs = []string{}
+
+	man := imageManifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeManifest,
+		Layers:        []descriptor{},
+	}
+
+	for i, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		name := manifest.Name
+		if i > 0 {
+			name = fmt.Sprintf("%s-%s", manifest.Name, c.Name)
+		}
+		if len(c.Files) == 0 {
+			logrus.Infof("Component %s has no layer because it does not provide any files", name)
+			continue
+		}
+
+		entries, err := staging.Collect(sourceWriter.Path(), c)
+		if err != nil {
+			return results, fmt.Errorf("reading files of %s: %w", name, err)
+		}
+		entries = staging.WithoutGhosts(entries)
+
+		layer, diffID, err := writeLayer(layoutDir, staging.WithParents(entries))
+		if err != nil {
+			return results, fmt.Errorf("writing layer of %s: %w", name, err)
+		}
+		layer.Annotations = map[string]string{annotationTitle: name}
+		man.Layers = append(man.Layers, layer)
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+		config.History = append(config.History, history{
+			Created: created, CreatedBy: "baggr", Comment: name,
+		})
+	}
+
+	if len(man.Layers) == 0 {
+		return results, fmt.Errorf("unable to build image, no files defined in the manifest")
+	}
+
+	man.Config, err = writeJSONBlob(layoutDir, mediaTypeConfig, config)
+	if err != nil {
+		return results, fmt.Errorf("writing image config: %w", err)
+	}
+
+	manDesc, err := writeJSONBlob(layoutDir, mediaTypeManifest, man)
+	if err != nil {
+		return results, fmt.Errorf("writing image manifest: %w", err)
+	}
+	manDesc.Annotations = map[string]string{annotationRefName: ver.String}
+
+	if err := writeJSON(filepath.Join(layoutDir, "index.json"), index{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeIndex,
+		Manifests:     []descriptor{manDesc},
+	}); err != nil {
+		return results, fmt.Errorf("writing image index: %w", err)
+	}
+
+	if err := writeJSON(filepath.Join(layoutDir, "oci-layout"), map[string]string{
+		"imageLayoutVersion": layoutVersion,
+	}); err != nil {
+		return results, fmt.Errorf("writing layout file: %w", err)
+	}
+
+	outPath := layoutDir
+	if format == FormatArchive {
+		outPath = filepath.Join(opts.OutputDir, baseName+".oci.tar")
+		if err := writeLayoutArchive(layoutDir, outPath); err != nil {
+			return results, fmt.Errorf("writing image archive: %w", err)
+		}
+	}
+
+	logrus.Infof("Wrote: %s", outPath)
+	results.Artifacts = append(results.Artifacts, build.NewFileArtifact(outPath))
+	return results, nil
+}
+
+// writeLayer writes the gzipped layer tarball to the blobs directory. It
+// returns the layer descriptor and the digest of the uncompressed tar.
+func writeLayer(layoutDir string, entries []*staging.Entry) (descriptor, string, error) {
+	f, err := os.CreateTemp(filepath.Join(layoutDir, "blobs", "sha256"), "layer-*")
+	if err != nil {
+		return descriptor{}, "", fmt.Errorf("creating layer file: %w", err)
+	}
+	defer f.Close()
+	if err := f.Chmod(os.FileMode(0o644)); err != nil {
+		return descriptor{}, "", fmt.Errorf("setting layer permissions: %w", err)
+	}
+
+	blobHash := sha256.New()
+	diffHash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(f, blobHash))
+	tw := tar.NewWriter(io.MultiWriter(gz, diffHash))
+
+	if err := staging.WriteTar(tw, "", entries); err != nil {
+		return descriptor{}, "", err
+	}
+	if err := tw.Close(); err != nil {
+		return descriptor{}, "", fmt.Errorf("closing tar stream: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return descriptor{}, "", fmt.Errorf("closing gzip stream: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return descriptor{}, "", fmt.Errorf("reading layer size: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return descriptor{}, "", fmt.Errorf("closing layer file: %w", err)
+	}
+
+	sum := hex.EncodeToString(blobHash.Sum(nil))
+	if err := os.Rename(f.Name(), filepath.Join(layoutDir, "blobs", "sha256", sum)); err != nil {
+		return descriptor{}, "", fmt.Errorf("moving layer blob: %w", err)
+	}
+
+	return descriptor{
+		MediaType: mediaTypeLayer,
+		Digest:    "sha256:" + sum,
+		Size:      info.Size(),
+	}, "sha256:" + hex.EncodeToString(diffHash.Sum(nil)), nil
+}
+
+// writeJSONBlob stores the marshaled object as a blob and returns its descriptor
+func writeJSONBlob(layoutDir, mediaType string, obj any) (descriptor, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return descriptor{}, fmt.Errorf("marshaling %s: %w", mediaType, err)
+	}
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(
+		filepath.Join(layoutDir, "blobs", "sha256", digest), data, os.FileMode(0o644),
+	); err != nil {
+		return descriptor{}, fmt.Errorf("writing blob: %w", err)
+	}
+	return descriptor{MediaType: mediaType, Digest: "sha256:" + digest, Size: int64(len(data))}, nil
+}
+
+func writeJSON(path string, obj any) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	return os.WriteFile(path, data, os.FileMode(0o644))
+}
+
+// writeLayoutArchive writes the contents of the layout directory to an
+// uncompressed tarball that can be read as an oci-archive
+func writeLayoutArchive(layoutDir, archivePath string) error {
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return fmt.Errorf("creating archive file: %w", err)
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	if err := filepath.WalkDir(layoutDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(layoutDir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		hdr.Uid, hdr.Gid, hdr.Uname, hdr.Gname = 0, 0, "", ""
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing header for %s: %w", rel, err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		blob, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer blob.Close()
+		if _, err := io.Copy(tw, blob); err != nil {
+			return fmt.Errorf("copying %s: %w", rel, err)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar stream: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging/stagingtest"
+)
+
+// readBlob reads a blob from the layout and checks its digest
+func readBlob(t *testing.T, layoutDir string, desc descriptor) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(layoutDir, "blobs", "sha256", strings.TrimPrefix(desc.Digest, "sha256:")))
+	require.NoError(t, err)
+	require.Equal(t, desc.Size, int64(len(data)))
+	sum := sha256.Sum256(data)
+	require.Equal(t, desc.Digest, "sha256:"+hex.EncodeToString(sum[:]))
+	return data
+}
+
+func TestBuildImage(t *testing.T) {
+	t.Parallel()
+	ctx := stagingtest.Context("1.0.0", "")
+	swTemp := stagingtest.Dir(t, map[string]string{"etc/test.conf": "a=b\n"})
+
+	man := stagingtest.Manifest()
+	man.Files[0].UID = "1000"
+	man.Components = []*spec.Component{
+		{Name: "empty"},
+		{Name: "config", Files: []*spec.File{{Source: "etc/test.conf", Destination: "/etc/test.conf"}}},
+	}
+
+	outDir := t.TempDir()
+	di := defaultImplementation{}
+	res, err := di.BuildImage(ctx, &build.Options{OutputDir: outDir}, source.NewDirWriter(swTemp), man, FormatLayout)
+	require.NoError(t, err)
+	require.Len(t, res.Artifacts, 1)
+	layoutDir := res.Artifacts[0].Path()
+	require.Equal(t, "test-1.0.0-oci", filepath.Base(layoutDir))
+
+	data, err := os.ReadFile(filepath.Join(layoutDir, "index.json"))
+	require.NoError(t, err)
+	var idx index
+	require.NoError(t, json.Unmarshal(data, &idx))
+	require.Len(t, idx.Manifests, 1)
+	require.Equal(t, "1.0.0", idx.Manifests[0].Annotations[annotationRefName])
+
+	var im imageManifest
+	require.NoError(t, json.Unmarshal(readBlob(t, layoutDir, idx.Manifests[0]), &im))
+	require.Len(t, im.Layers, 2)
+
+	var config imageConfig
+	require.NoError(t, json.Unmarshal(readBlob(t, layoutDir, im.Config), &config))
+	require.Len(t, config.RootFS.DiffIDs, 2)
+	require.Len(t, config.History, 2)
+
+	layerFiles := []map[string]*tar.Header{}
+	for i, layer := range im.Layers {
+		gz, err := gzip.NewReader(bytes.NewReader(readBlob(t, layoutDir, layer)))
+		require.NoError(t, err)
+		diffHash := sha256.New()
+		tr := tar.NewReader(io.TeeReader(gz, diffHash))
+		files := map[string]*tar.Header{}
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			files[hdr.Name] = hdr
+		}
+		_, err = io.Copy(io.Discard, gz)
+		require.NoError(t, err)
+		require.Equal(t, config.RootFS.DiffIDs[i], "sha256:"+hex.EncodeToString(diffHash.Sum(nil)))
+		layerFiles = append(layerFiles, files)
+	}
+
+	require.Equal(t, "test", im.Layers[0].Annotations[annotationTitle])
+	require.Contains(t, layerFiles[0], "usr/bin/")
+	require.Equal(t, int64(0o755), layerFiles[0]["usr/bin/test"].Mode)
+	require.Equal(t, 1000, layerFiles[0]["usr/bin/test"].Uid)
+
+	require.Equal(t, "test-config", im.Layers[1].Annotations[annotationTitle])
+	require.Contains(t, layerFiles[1], "etc/test.conf")
+	require.NotContains(t, layerFiles[1], "usr/bin/test")
+}
@@ -0,0 +1,64 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package oci is a baggr implementation that writes the files of a manifest
+// as an OCI image with one layer per component.
+package oci
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// Format is the way the image layout is written to disk
+type Format string
+
+const (
+	// FormatLayout writes the image layout as a directory
+	FormatLayout Format = "oci"
+
+	// FormatArchive writes the image layout in a tarball
+	FormatArchive Format = "oci-archive"
+)
+
+// New returns a worker that writes the image in the specified format
+func New(format Format) *Worker {
+	return &Worker{
+		format:         format,
+		implementation: &defaultImplementation{},
+	}
+}
+
+type Worker struct {
+	format         Format
+	implementation Implementation
+}
+
+// BuildPackages takes a manifest and writes an OCI image layout with a
+// layer for each component that has files.
+func (w *Worker) BuildPackages(ctx context.Context, manifest *spec.Manifest, opts *build.Options) (build.Result, error) {
+	var results build.Result
+	// Create a temp directory to stage the files
+	tmp, err := os.MkdirTemp("", "baggr-ociroot-*")
+	if err != nil {
+		return results, fmt.Errorf("creating temporary staging directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	sourceWriter := source.NewDirWriter(tmp)
+
+	if err := w.implementation.CopySourceFiles(ctx, opts, sourceWriter, manifest); err != nil {
+		return results, fmt.Errorf("copying image files: %w", err)
+	}
+
+	results, err = w.implementation.BuildImage(ctx, opts, sourceWriter, manifest, w.format)
+	if err != nil {
+		return results, fmt.Errorf("writing OCI image: %w", err)
+	}
+
+	return results, nil
+}
@@ -0,0 +1,373 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package pacman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5" //nolint:gosec // mtree files carry md5 digests
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+const (
+	architecture = "any"
+
+	// DefaultPackager is written to packages built from manifests that
+	// don't define a maintainer, it is the same value makepkg uses.
+	DefaultPackager = "Unknown Packager"
+)
+
+type Implementation interface {
+	CopySourceFiles(context.Context, *build.Options, source.Writer, *spec.Manifest) error
+	BuildPacmanPackages(context.Context, *build.Options, source.Writer, *spec.Manifest) (build.Result, error)
+}
+
+type defaultImplementation struct{}
+
+// pkgInfo holds the package metadata written to .PKGINFO
+type pkgInfo struct {
+	Name        string
+	Base        string
+	Version     string
+	Description string
+	URL         string
+	License     string
+	Packager    string
+	BuildDate   int64
+	Size        int64
+	Replaces    []string
+	Conflicts   []string
+	Provides    []string
+	Backup      []string
+	Depends     []string
+	OptDepends  []string
+}
+
+// String renders the .PKGINFO file
+func (pi *pkgInfo) String() string {
+	var b strings.Builder
+	b.WriteString("# Generated by baggr\n")
+	fmt.Fprintf(&b, "pkgname = %s\n", pi.Name)
+	fmt.Fprintf(&b, "pkgbase = %s\n", pi.Base)
+	fmt.Fprintf(&b, "pkgver = %s\n", pi.Version)
+	fmt.Fprintf(&b, "pkgdesc = %s\n", pi.Description)
+	if pi.URL != "" {
+		fmt.Fprintf(&b, "url = %s\n", pi.URL)
+	}
+	fmt.Fprintf(&b, "builddate = %d\n", pi.BuildDate)
+	fmt.Fprintf(&b, "packager = %s\n", pi.Packager)
+	fmt.Fprintf(&b, "size = %d\n", pi.Size)
+	fmt.Fprintf(&b, "arch = %s\n", architecture)
+	if pi.License != "" {
+		fmt.Fprintf(&b, "license = %s\n", pi.License)
+	}
+	for _, field := range []struct {
+		key     string
+		entries []string
+	}{
+		{"replaces", pi.Replaces},
+		{"conflict", pi.Conflicts},
+		{"provides", pi.Provides},
+		{"backup", pi.Backup},
+		{"depend", pi.Depends},
+		{"optdepend", pi.OptDepends},
+	} {
+		for _, e := range field.entries {
+			fmt.Fprintf(&b, "%s = %s\n", field.key, e)
+		}
+	}
+	return b.String()
+}
+
+// CopySourceFiles copies the files from the source reader using the source writer
+func (di *defaultImplementation) CopySourceFiles(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) error {
+	return staging.CopyFiles(ctx, opts, sourceWriter, manifest)
+}
+
+// BuildPacmanPackages writes a package for the main component and one for
+// each of the subcomponents that has files.
+func (di *defaultImplementation) BuildPacmanPackages(
+	ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest,
+) (results build.Result, err error) {
+	results = build.Result{Artifacts: []build.Artifact{}}
+	if len(manifest.Files) == 0 {
+		return results, fmt.Errorf("unable to build pacman package, no files defined in top level project")
+	}
+
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return results, fmt.Errorf("resolving package version: %w", err)
+	}
+	pkgrel := ver.Release
+	if pkgrel == "" || pkgrel == "0" {
+		// pacman releases start at 1
+		pkgrel = "1"
+	}
+	pkgver := fmt.Sprintf("%s-%s", version.TranslatePacman(ver.String), pkgrel)
+
+	packager := manifest.Maintainer
+	if packager == "" {
+		packager = DefaultPackager
+	}
+
+	for i, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		name := manifest.Name
+		if i > 0 {
+			if len(c.Files) == 0 {
+				logrus.Infof("Component %s not packaged because it does not provide any files", c.Name)
+				continue
+			}
+			name = fmt.Sprintf("%s-%s", manifest.Name, c.Name)
+		}
+		name = strings.ToLower(name)
+
+		entries, err := staging.Collect(sourceWriter.Path(), c)
+		if err != nil {
+			return results, fmt.Errorf("reading files of %s: %w", name, err)
+		}
+		entries = staging.WithoutGhosts(entries)
+
+		// Recommended and suggested packages are optional dependencies,
+		// pacman has no equivalent of supplements
+		if len(c.Supplements) > 0 {
+			logrus.Warnf("Package %s: pacman packages don't support supplements, skipping them", name)
+		}
+		info := &pkgInfo{
+			Name:        name,
+			Base:        strings.ToLower(manifest.Name),
+			Version:     pkgver,
+			Description: c.Summary,
+			URL:         manifest.URL,
+			License:     c.License,
+			Packager:    packager,
+			BuildDate:   time.Now().Unix(),
+			Replaces:    depends(c.Obsoletes),
+			Conflicts:   depends(slices.Concat(c.Conflicts, c.Obsoletes)),
+			Provides:    depends(c.Provides),
+			Depends:     depends(c.Requires),
+			OptDepends:  depends(slices.Concat(c.Recommends, c.Suggests)),
+			Backup:      backup(entries),
+		}
+		if info.License == "" {
+			info.License = manifest.License
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				info.Size += e.Size
+			}
+		}
+
+		pkgPath := filepath.Join(opts.OutputDir, fmt.Sprintf("%s-%s-%s.pkg.tar.zst", name, pkgver, architecture))
+		if err := writePackage(pkgPath, info, installScript(name, &c.Scripts), staging.WithParents(entries)); err != nil {
+			return results, fmt.Errorf("writing %s: %w", name, err)
+		}
+		logrus.Infof("Wrote: %s", pkgPath)
+		results.Artifacts = append(results.Artifacts, build.NewFileArtifact(pkgPath))
+	}
+	return results, nil
+}
+
+// metaFile is a package metadata file written before the package files
+type metaFile struct {
+	name string
+	data []byte
+}
+
+// writePackage writes the zstd compressed package tarball. The metadata
+// files go first so pacman can read them without scanning the archive.
+func writePackage(pkgPath string, info *pkgInfo, install string, entries []*staging.Entry) error {
+	meta := []metaFile{{".PKGINFO", []byte(info.String())}}
+	if install != "" {
+		meta = append(meta, metaFile{".INSTALL", []byte(install)})
+	}
+	mtree, err := buildMtree(meta, time.Unix(info.BuildDate, 0), entries)
+	if err != nil {
+		return fmt.Errorf("building .MTREE: %w", err)
+	}
+	meta = append(meta, metaFile{".MTREE", mtree})
+
+	f, err := os.Create(pkgPath)
+	if err != nil {
+		return fmt.Errorf("creating package file: %w", err)
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return fmt.Errorf("creating zstd writer: %w", err)
+	}
+	tw := tar.NewWriter(zw)
+
+	for _, meta := range meta {
+		if err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg, Name: meta.name, Mode: 0o644, Size: int64(len(meta.data)),
+			Uname: staging.DefaultOwner, Gname: staging.DefaultOwner,
+			ModTime: time.Unix(info.BuildDate, 0), Format: tar.FormatGNU,
+		}); err != nil {
+			return fmt.Errorf("writing %s header: %w", meta.name, err)
+		}
+		if _, err := tw.Write(meta.data); err != nil {
+			return fmt.Errorf("writing %s: %w", meta.name, err)
+		}
+	}
+
+	if err := staging.WriteTar(tw, "", entries); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing tar stream: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing zstd stream: %w", err)
+	}
+	return f.Close()
+}
+
+// buildMtree returns the gzipped mtree file that pacman uses to verify
+// the installed files
+func buildMtree(meta []metaFile, buildDate time.Time, entries []*staging.Entry) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("#mtree\n")
+	b.WriteString("/set type=file uid=0 gid=0 mode=644\n")
+	for _, m := range meta {
+		fmt.Fprintf(
+			&b, "./%s time=%d.0 size=%d md5digest=%x sha256digest=%x\n",
+			m.name, buildDate.Unix(), len(m.data), md5.Sum(m.data), sha256.Sum256(m.data), //nolint:gosec // mtree digest
+		)
+	}
+
+	for _, e := range entries {
+		fmt.Fprintf(&b, "./%s time=%d.0", mtreeEscape(strings.TrimPrefix(e.Path, "/")), e.ModTime.Unix())
+		if e.UID != 0 {
+			fmt.Fprintf(&b, " uid=%d", e.UID)
+		}
+		if e.GID != 0 {
+			fmt.Fprintf(&b, " gid=%d", e.GID)
+		}
+		hdr := e.TarHeader()
+		if hdr.Mode != 0o644 {
+			fmt.Fprintf(&b, " mode=%o", hdr.Mode)
+		}
+		switch {
+		case e.IsDir():
+			b.WriteString(" type=dir")
+		case e.IsSymlink():
+			fmt.Fprintf(&b, " type=link link=%s", mtreeEscape(e.Linkname))
+		default:
+			md5sum, err := e.Digest(md5.New()) //nolint:gosec // mtree digest
+			if err != nil {
+				return nil, err
+			}
+			sha256sum, err := e.Digest(sha256.New())
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&b, " size=%d md5digest=%s sha256digest=%s", e.Size, md5sum, sha256sum)
+		}
+		b.WriteString("\n")
+	}
+
+	var out bytes.Buffer
+	gz := gzip.NewWriter(&out)
+	if _, err := gz.Write([]byte(b.String())); err != nil {
+		return nil, fmt.Errorf("compressing mtree: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("closing gzip stream: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// installScript returns the .INSTALL file with the component scripts. The
+// install scripts also run on upgrades, as in rpm. pacman has no
+// transaction hooks so pretrans and posttrans are not packaged.
+func installScript(name string, s *spec.Scripts) string {
+	if s.PreTrans.Defined() || s.PostTrans.Defined() {
+		logrus.Warnf("Package %s: pacman packages don't support pretrans and posttrans scripts, skipping them", name)
+	}
+
+	var b strings.Builder
+	for _, is := range []struct {
+		functions []string
+		script    *spec.Script
+	}{
+		{[]string{"pre_install", "pre_upgrade"}, &s.PreInstall},
+		{[]string{"post_install", "post_upgrade"}, &s.PostInstall},
+		{[]string{"pre_remove"}, &s.PreUninstall},
+		{[]string{"post_remove"}, &s.PostUninstall},
+	} {
+		if !is.script.Defined() {
+			continue
+		}
+		body := strings.TrimRight(is.script.Body(), "\n")
+		// pacman sources the file with bash, other interpreters get the
+		// script in their standard input
+		switch path.Base(strings.Fields(is.script.Interpreter())[0]) {
+		case "sh", "bash":
+		default:
+			body = fmt.Sprintf("%s <<'BAGGR_SCRIPT'\n%s\nBAGGR_SCRIPT", is.script.Interpreter(), body)
+		}
+		for _, f := range is.functions {
+			fmt.Fprintf(&b, "%s() {\n%s\n}\n\n", f, body)
+		}
+	}
+	return b.String()
+}
+
+// mtreeEscape encodes the characters that are not allowed in mtree paths
+// as octal escapes
+func mtreeEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c <= ' ' || c >= 0x7f || c == '\\' || c == '#' || c == '=' {
+			fmt.Fprintf(&b, "\\%03o", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// backup returns the config files of the package, pacman keeps the
+// changes made to them and installs the new versions as .pacnew files
+func backup(entries []*staging.Entry) []string {
+	res := []string{}
+	for _, e := range entries {
+		if e.Is(spec.FileTypeConfig) && e.Mode.IsRegular() {
+			res = append(res, strings.TrimPrefix(e.Path, "/"))
+		}
+	}
+	return res
+}
+
+// depends translates the manifest relations to pacman dependencies,
+// eg "perl >= 5.0" becomes "perl>=5.0"
+func depends(rels spec.Relations) []string {
+	res := []string{}
+	for _, r := range rels {
+		res = append(res, r.Name+r.Operator+r.Version)
+	}
+	return res
+}
@@ -0,0 +1,97 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package pacman
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging/stagingtest"
+)
+
+func TestBuildPacmanPackages(t *testing.T) {
+	t.Parallel()
+	ctx := stagingtest.Context("1.0.0", "0")
+	swTemp := stagingtest.Dir(t, map[string]string{"etc/test.conf": "debug=0\n"})
+
+	man := stagingtest.Manifest(
+		&spec.File{Source: "etc/test.conf", Destination: "/etc/test.conf", Type: spec.FileTypeConfig},
+		&spec.File{Destination: "/var/log/test.log", Type: spec.FileTypeGhost},
+	)
+	man.License = "MIT"
+	man.Requires = spec.Relations{{Name: "bash", Operator: ">=", Version: "4.0"}}
+	man.Obsoletes = spec.Relations{{Name: "old-test"}}
+	man.Recommends = spec.Relations{{Name: "test-docs"}}
+
+	di := defaultImplementation{}
+	res, err := di.BuildPacmanPackages(ctx, &build.Options{OutputDir: t.TempDir()}, source.NewDirWriter(swTemp), man)
+	require.NoError(t, err)
+	require.Len(t, res.Artifacts, 1)
+	require.Equal(t, "test-1.0.0-1-any.pkg.tar.zst", filepath.Base(res.Artifacts[0].Path()))
+
+	f, err := os.Open(res.Artifacts[0].Path())
+	require.NoError(t, err)
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	require.NoError(t, err)
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	names := []string{}
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = data
+	}
+	require.Equal(t, []string{".PKGINFO", ".MTREE", "etc/", "etc/test.conf", "usr/", "usr/bin/", "usr/bin/test"}, names)
+	require.Contains(t, string(files[".PKGINFO"]), "pkgver = 1.0.0-1\n")
+	require.Contains(t, string(files[".PKGINFO"]),
+		"replaces = old-test\nconflict = old-test\nbackup = etc/test.conf\ndepend = bash>=4.0\noptdepend = test-docs\n")
+	require.Contains(t, string(files[".PKGINFO"]), "size = 18\n")
+
+	gz, err := gzip.NewReader(bytes.NewReader(files[".MTREE"]))
+	require.NoError(t, err)
+	mtree, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	require.Contains(t, string(mtree), "./usr/bin time=")
+	require.Contains(t, string(mtree), " type=dir\n")
+	require.Contains(t, string(mtree), " mode=755 size=10 md5digest=")
+}
+
+func TestMtreeEscape(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "usr/share/my\\040file", mtreeEscape("usr/share/my file"))
+	require.Equal(t, "a\\043b\\075c", mtreeEscape("a#b=c"))
+}
+
+func TestInstallScript(t *testing.T) {
+	t.Parallel()
+	require.Empty(t, installScript("test", &spec.Scripts{}))
+
+	install := installScript("test", &spec.Scripts{
+		PostInstall:  spec.Script{Inline: "systemctl daemon-reload\n"},
+		PreUninstall: spec.Script{Inline: "#!/usr/bin/python3\nprint('bye')\n"},
+	})
+	require.Contains(t, install, "post_install() {\nsystemctl daemon-reload\n}\n")
+	require.Contains(t, install, "post_upgrade() {\nsystemctl daemon-reload\n}\n")
+	require.Contains(t, install, "pre_remove() {\n/usr/bin/python3 <<'BAGGR_SCRIPT'\nprint('bye')\nBAGGR_SCRIPT\n}\n")
+	require.NotContains(t, install, "pre_install")
+}
@@ -0,0 +1,100 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package rpm
+
+import (
+	"fmt"
+	"io"
+)
+
+const (
+	cpioMagic   = "070701"
+	cpioTrailer = "TRAILER!!!"
+
+	// cpioMaxFileSize is the largest file the eight hex digits of the
+	// newc size field can hold
+	cpioMaxFileSize = 1<<32 - 1
+)
+
+// cpioHeader is an entry header of the "new ASCII" (newc) cpio format used
+// in RPM payloads.
+type cpioHeader struct {
+	Inode    int
+	Mode     uint32
+	UID      int
+	GID      int
+	Nlink    int
+	MTime    int64
+	FileSize int64
+	Name     string
+}
+
+// cpioWriter writes newc cpio archives
+type cpioWriter struct {
+	w       io.Writer
+	written int64
+}
+
+func newCpioWriter(w io.Writer) *cpioWriter {
+	return &cpioWriter{w: w}
+}
+
+// WriteHeader writes the header and name of an entry
+func (cw *cpioWriter) WriteHeader(hdr *cpioHeader) error {
+	if hdr.FileSize > cpioMaxFileSize {
+		return fmt.Errorf("%s is larger than the %d bytes a cpio payload can hold", hdr.Name, int64(cpioMaxFileSize))
+	}
+	name := hdr.Name + "\x00"
+	if err := cw.writeString(fmt.Sprintf(
+		"%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+		cpioMagic, hdr.Inode, hdr.Mode, hdr.UID, hdr.GID, hdr.Nlink, hdr.MTime,
+		hdr.FileSize, 0, 0, 0, 0, len(name), 0,
+	)); err != nil {
+		return fmt.Errorf("writing cpio header: %w", err)
+	}
+	if err := cw.writeString(name); err != nil {
+		return fmt.Errorf("writing cpio file name: %w", err)
+	}
+	return cw.pad()
+}
+
+// Write writes file data to the archive
+func (cw *cpioWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.written += int64(n)
+	return n, err
+}
+
+// EndFile pads the archive after the file data
+func (cw *cpioWriter) EndFile() error {
+	return cw.pad()
+}
+
+// Close writes the archive trailer. It does not close the underlying writer.
+func (cw *cpioWriter) Close() error {
+	if err := cw.WriteHeader(&cpioHeader{Name: cpioTrailer, Nlink: 1}); err != nil {
+		return fmt.Errorf("writing trailer: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of bytes written to the archive
+func (cw *cpioWriter) Len() int64 {
+	return cw.written
+}
+
+func (cw *cpioWriter) writeString(s string) error {
+	_, err := io.WriteString(cw, s)
+	return err
+}
+
+// pad aligns the stream to four bytes
+func (cw *cpioWriter) pad() error {
+	if n := cw.written % 4; n != 0 {
+		if _, err := cw.Write(make([]byte, 4-n)); err != nil {
+			return fmt.Errorf("padding cpio stream: %w", err)
+		}
+	}
+	return nil
+}
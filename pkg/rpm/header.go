@@ -0,0 +1,263 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package rpm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Header data types as defined in the RPM file format
+const (
+	typeInt16       = 3
+	typeInt32       = 4
+	typeInt64       = 5
+	typeString      = 6
+	typeBinary      = 7
+	typeStringArray = 8
+	typeI18NString  = 9
+)
+
+// Region tags that mark the signature and immutable header regions
+const (
+	tagHeaderSignatures = 62
+	tagHeaderImmutable  = 63
+	tagHeaderI18NTable  = 100
+)
+
+// Signature header tags
+const (
+	sigTagSHA1            = 269
+	sigTagLongSize        = 270
+	sigTagLongArchiveSize = 271
+	sigTagSHA256          = 273
+	sigTagSize            = 1000
+	sigTagPayloadSize     = 1007
+)
+
+// Main header tags
+const (
+	tagName              = 1000
+	tagVersion           = 1001
+	tagRelease           = 1002
+	tagSummary           = 1004
+	tagDescription       = 1005
+	tagBuildTime         = 1006
+	tagBuildHost         = 1007
+	tagSize              = 1009
+	tagLicense           = 1014
+	tagGroup             = 1016
+	tagURL               = 1020
+	tagOS                = 1021
+	tagArch              = 1022
+	tagPreIn             = 1023
+	tagPostIn            = 1024
+	tagPreUn             = 1025
+	tagPostUn            = 1026
+	tagFileSizes         = 1028
+	tagFileModes         = 1030
+	tagFileRDevs         = 1033
+	tagFileMTimes        = 1034
+	tagFileDigests       = 1035
+	tagFileLinkTos       = 1036
+	tagFileFlags         = 1037
+	tagFileUserName      = 1039
+	tagFileGroupName     = 1040
+	tagSourceRPM         = 1044
+	tagFileVerifyFlags   = 1045
+	tagProvideName       = 1047
+	tagRequireFlags      = 1048
+	tagRequireName       = 1049
+	tagRequireVersion    = 1050
+	tagConflictFlags     = 1053
+	tagConflictName      = 1054
+	tagConflictVersion   = 1055
+	tagRPMVersion        = 1064
+	tagPreInProg         = 1085
+	tagPostInProg        = 1086
+	tagPreUnProg         = 1087
+	tagPostUnProg        = 1088
+	tagObsoleteName      = 1090
+	tagFileDevices       = 1095
+	tagFileInodes        = 1096
+	tagFileLangs         = 1097
+	tagProvideFlags      = 1112
+	tagProvideVersion    = 1113
+	tagObsoleteFlags     = 1114
+	tagObsoleteVersion   = 1115
+	tagDirIndexes        = 1116
+	tagBaseNames         = 1117
+	tagDirNames          = 1118
+	tagPayloadFormat     = 1124
+	tagPayloadCompressor = 1125
+	tagPayloadFlags      = 1126
+	tagPreTrans          = 1151
+	tagPostTrans         = 1152
+	tagPreTransProg      = 1153
+	tagPostTransProg     = 1154
+	tagLongSize          = 5009
+	tagFileDigestAlgo    = 5011
+	tagRecommendName     = 5046
+	tagRecommendVersion  = 5047
+	tagRecommendFlags    = 5048
+	tagSuggestName       = 5049
+	tagSuggestVersion    = 5050
+	tagSuggestFlags      = 5051
+	tagSupplementName    = 5052
+	tagSupplementVersion = 5053
+	tagSupplementFlags   = 5054
+)
+
+// headerMagic starts every header structure in the RPM file
+var headerMagic = []byte{0x8e, 0xad, 0xe8, 0x01, 0, 0, 0, 0}
+
+// headerEntry is the data of a tag in the header store
+type headerEntry struct {
+	dataType int32
+	count    int32
+	data     []byte
+}
+
+// alignment returns the padding needed to store the entry data at offset
+func (e *headerEntry) alignment(offset int) int {
+	var size int
+	switch e.dataType {
+	case typeInt16:
+		size = 2
+	case typeInt32:
+		size = 4
+	case typeInt64:
+		size = 8
+	default:
+		return 0
+	}
+	if offset%size == 0 {
+		return 0
+	}
+	return size - offset%size
+}
+
+// header is an RPM header structure. The same structure is used for the
+// signature and the main package header, they only differ in their region tag.
+type header struct {
+	region  int32
+	entries map[int32]*headerEntry
+}
+
+func newHeader(region int32) *header {
+	return &header{
+		region:  region,
+		entries: map[int32]*headerEntry{},
+	}
+}
+
+// addString adds a string tag to the header
+func (h *header) addString(tag int32, s string) {
+	h.entries[tag] = &headerEntry{dataType: typeString, count: 1, data: append([]byte(s), 0)}
+}
+
+// addI18NString adds a localizable string. We only ship the "C" locale.
+func (h *header) addI18NString(tag int32, s string) {
+	h.entries[tag] = &headerEntry{dataType: typeI18NString, count: 1, data: append([]byte(s), 0)}
+}
+
+// addStringArray adds an array of strings to the header
+func (h *header) addStringArray(tag int32, strs []string) {
+	var b bytes.Buffer
+	for _, s := range strs {
+		b.WriteString(s)
+		b.WriteByte(0)
+	}
+	h.entries[tag] = &headerEntry{dataType: typeStringArray, count: int32(len(strs)), data: b.Bytes()}
+}
+
+// addInt32 adds one or more 32 bit integers to the header
+func (h *header) addInt32(tag int32, values ...int32) {
+	data := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint32(data[i*4:], uint32(v))
+	}
+	h.entries[tag] = &headerEntry{dataType: typeInt32, count: int32(len(values)), data: data}
+}
+
+// addInt64 adds one or more 64 bit integers to the header
+func (h *header) addInt64(tag int32, values ...int64) {
+	data := make([]byte, 8*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint64(data[i*8:], uint64(v))
+	}
+	h.entries[tag] = &headerEntry{dataType: typeInt64, count: int32(len(values)), data: data}
+}
+
+// addSize adds a size to the header. rpm reads the 32 bit sizes as
+// unsigned, the larger ones are stored as 64 bit integers in longTag.
+func (h *header) addSize(tag, longTag int32, size int64) {
+	if size > math.MaxUint32 {
+		h.addInt64(longTag, size)
+		return
+	}
+	h.addInt32(tag, int32(uint32(size)))
+}
+
+// addInt16 adds one or more 16 bit integers to the header
+func (h *header) addInt16(tag int32, values ...int16) {
+	data := make([]byte, 2*len(values))
+	for i, v := range values {
+		binary.BigEndian.PutUint16(data[i*2:], uint16(v))
+	}
+	h.entries[tag] = &headerEntry{dataType: typeInt16, count: int32(len(values)), data: data}
+}
+
+// Bytes serializes the header. The region tag is written as the first
+// index entry but its data (a trailer pointing back to the index) is stored
+// at the end of the data store.
+func (h *header) Bytes() ([]byte, error) {
+	tags := make([]int32, 0, len(h.entries))
+	for t := range h.entries {
+		tags = append(tags, t)
+	}
+	slices.Sort(tags)
+
+	store := bytes.Buffer{}
+	offsets := make([]int, len(tags))
+	for i, t := range tags {
+		e := h.entries[t]
+		store.Write(make([]byte, e.alignment(store.Len())))
+		offsets[i] = store.Len()
+		store.Write(e.data)
+	}
+
+	// The region trailer is an index entry whose offset is the negative
+	// size of the index, including the region entry itself.
+	regionOffset := store.Len()
+	indexCount := int32(len(tags) + 1)
+	trailer := make([]byte, 16)
+	binary.BigEndian.PutUint32(trailer[0:], uint32(h.region))
+	binary.BigEndian.PutUint32(trailer[4:], typeBinary)
+	binary.BigEndian.PutUint32(trailer[8:], uint32(-indexCount*16))
+	binary.BigEndian.PutUint32(trailer[12:], 16)
+	store.Write(trailer)
+
+	out := bytes.Buffer{}
+	out.Write(headerMagic)
+	if err := binary.Write(&out, binary.BigEndian, []int32{indexCount, int32(store.Len())}); err != nil {
+		return nil, fmt.Errorf("writing header intro: %w", err)
+	}
+
+	// Write the region entry first, then the rest of the index
+	if err := binary.Write(&out, binary.BigEndian, []int32{h.region, typeBinary, int32(regionOffset), 16}); err != nil {
+		return nil, fmt.Errorf("writing region index entry: %w", err)
+	}
+	for i, t := range tags {
+		e := h.entries[t]
+		if err := binary.Write(&out, binary.BigEndian, []int32{t, e.dataType, int32(offsets[i]), e.count}); err != nil {
+			return nil, fmt.Errorf("writing index entry for tag %d: %w", t, err)
+		}
+	}
+	out.Write(store.Bytes())
+	return out.Bytes(), nil
+}
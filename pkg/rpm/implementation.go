@@ -18,6 +18,8 @@ import (
 	"github.com/uservers/baggr/pkg/build"
 	"github.com/uservers/baggr/pkg/source"
 	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/version"
 )
 
 const DefaultDownloadURL = "http://www.ulabs.uservers.net/no-url"
@@ -25,30 +27,12 @@ const DefaultDownloadURL = "http://www.ulabs.uservers.net/no-url"
 type Implementation interface {
 	BuildRpmSpec(context.Context, *build.Options, source.Writer, *spec.Manifest) (string, error)
 	CopySourceFiles(context.Context, *build.Options, source.Writer, *spec.Manifest) error
-	BuildRpms(context.Context, *build.Options, string, source.Writer) (build.Result, error)
+	BuildRpms(context.Context, *build.Options, string, source.Writer, *spec.Manifest) (build.Result, error)
 	VerifyPackages() error
 }
 
 type defaultImplementation struct{}
 
-// CheckSourceFiles
-func (di *defaultImplementation) CheckSourceFiles(_ context.Context, manifest *spec.Manifest) error {
-	// TODO: Extract cwd from context
-	notFound := []string{}
-	for _, file := range manifest.Files {
-		if _, err := os.Stat(file.Source); err != nil {
-			if err != os.ErrNotExist {
-				return fmt.Errorf("error checking for file: %w", err)
-			}
-			notFound = append(notFound, file.Source)
-		}
-	}
-	if len(notFound) > 0 {
-		return fmt.Errorf("source files not found: %v", notFound)
-	}
-	return nil
-}
-
 // BuildRpmSpec builds the RPM spec file from the manifest data and returns the path
 func (di *defaultImplementation) BuildRpmSpec(
 	ctx context.Context, opts *build.Options, sourceWriter source.Writer, omanifest *spec.Manifest,
@@ -57,21 +41,11 @@ func (di *defaultImplementation) BuildRpmSpec(
 		return "", fmt.Errorf("unable to build spec, no files defined in top level project")
 	}
 
-	// Get the package version
-	ver := opts.Version
-	// if there is no specific version set in the options, then
-	// we MUST have an autocomputed version in the options.
-	if opts.Version == nil {
-		buildContext := ctx.Value(build.ContextKey{})
-		if buildContext == nil {
-			return "", errors.New("unable to read build context")
-		}
-
-		if bc, ok := buildContext.(build.Context); ok {
-			if ver = bc.Version; ver == nil {
-				return "", errors.New("no version set in options or found in build context")
-			}
-		}
+	// Get the package version. If there is no specific version set in
+	// the options, then we MUST have an autocomputed version in the context.
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return "", fmt.Errorf("getting package version: %w", err)
 	}
 
 	// Since we're altering the manifest, clone it as not to modify the original
@@ -119,7 +93,9 @@ func (di *defaultImplementation) BuildRpmSpec(
 		prepFileCommands += fmt.Sprintf("%%{__mkdir_p} %%{buildroot}%s || exit 111\n", dirname)
 	}
 
-	tmpl, err := template.New("template.tmpl").Parse(Template)
+	tmpl, err := template.New("template.tmpl").Funcs(template.FuncMap{
+		"fileDirectives": fileDirectives,
+	}).Parse(Template)
 	if err != nil {
 		return "", fmt.Errorf("error parsing template: %w", err)
 	}
@@ -132,9 +108,10 @@ func (di *defaultImplementation) BuildRpmSpec(
 	if err := tmpl.Execute(f, map[string]interface{}{
 		"Manifest":           manifest,
 		"PrepFileCommands":   prepFileCommands,
-		"Version":            ver.String,
+		"Version":            version.TranslateRPM(ver.String),
 		"Release":            ver.Release,
 		"BuildrootDirectory": buildrootDirectoryList,
+		"Scriptlets":         specScriptlets(manifest),
 	}); err != nil {
 		return "", fmt.Errorf("error executing template: %w", err)
 	}
@@ -143,28 +120,96 @@ func (di *defaultImplementation) BuildRpmSpec(
 	return f.Name(), nil
 }
 
+// fileDirectives returns the %files directives that precede the %attr of
+// a file, eg "%config(noreplace) %verify(not md5 mtime) "
+func fileDirectives(f *spec.File) string {
+	var b strings.Builder
+	switch f.Type {
+	case spec.FileTypeConfig:
+		opts := []string{}
+		if f.MissingOK {
+			opts = append(opts, "missingok")
+		}
+		if f.NoReplace {
+			opts = append(opts, "noreplace")
+		}
+		b.WriteString("%config")
+		if len(opts) > 0 {
+			b.WriteString("(" + strings.Join(opts, " ") + ")")
+		}
+		b.WriteString(" ")
+	case spec.FileTypeDoc, spec.FileTypeLicense, spec.FileTypeGhost, spec.FileTypeDir:
+		b.WriteString("%" + string(f.Type) + " ")
+	}
+	if len(f.NoVerify) > 0 {
+		b.WriteString("%verify(not " + strings.Join(f.NoVerify, " ") + ") ")
+	}
+	return b.String()
+}
+
+// specScriptlets returns the scriptlet sections of the main package and
+// the subpackages
+func specScriptlets(manifest *spec.Manifest) string {
+	var b strings.Builder
+	for i, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		for _, s := range scriptlets(&c.Scripts) {
+			if !s.script.Defined() {
+				continue
+			}
+			b.WriteString("%" + s.section)
+			if i > 0 {
+				b.WriteString(" " + c.Name)
+			}
+			if interpreter := s.script.Interpreter(); interpreter != spec.DefaultInterpreter {
+				b.WriteString(" -p " + interpreter)
+			}
+			b.WriteString("\n" + strings.TrimRight(s.script.Body(), "\n") + "\n\n")
+		}
+	}
+	return b.String()
+}
+
+// scriptlet is a manifest script and the rpm section it runs in
+type scriptlet struct {
+	section string
+	script  *spec.Script
+}
+
+// scriptlets returns the component scripts in the order of the spec sections
+func scriptlets(s *spec.Scripts) []scriptlet {
+	return []scriptlet{
+		{"pretrans", &s.PreTrans},
+		{"pre", &s.PreInstall},
+		{"post", &s.PostInstall},
+		{"preun", &s.PreUninstall},
+		{"postun", &s.PostUninstall},
+		{"posttrans", &s.PostTrans},
+	}
+}
+
 // processComponentFiles
 func processComponentFiles(sourceWriter source.Writer, component *spec.Component) (prepFileCommands string, buildrootDirectoryList map[string]string) {
 	buildrootDirectoryList = map[string]string{}
 	for _, filedata := range component.Files {
 		// Handle directories, either empty/non-existent (expressed with '%DIR%') or
 		// already existing in the sourceWriter path, in which case they will be
-		// copied recursively.
-		if filedata.Source == DIR || util.IsDir(filepath.Join(sourceWriter.Path(), filedata.Destination)) {
-			prepFileCommands += fmt.Sprintf("%%{__mkdir_p} %%{buildroot}/%s\n", filedata.Destination)
+		// copied recursively. Globs are staged as directories.
+		stagedPath := filepath.Join(sourceWriter.Path(), filedata.DestinationPath())
+		if filedata.IsDir() || util.IsDir(stagedPath) {
+			prepFileCommands += fmt.Sprintf("%%{__mkdir_p} %%{buildroot}/%s\n", filedata.DestinationPath())
 
 			// If the file entry source exists in the sourcewriter's path, add
-			// instructions to the spec to copy it recursively:
-			if filedata.Source != DIR && util.IsDir(filepath.Join(sourceWriter.Path(), filedata.Destination)) {
+			// instructions to the spec to copy it recursively, keeping the
+			// links and the file attributes:
+			if !filedata.IsDir() && util.IsDir(stagedPath) {
 				prepFileCommands += fmt.Sprintf(
-					"%%{__cp} -rL %s/* $RPM_BUILD_ROOT/%s || :\n",
-					filepath.Join(sourceWriter.Path(), filedata.Source),
-					filedata.Destination,
+					"%%{__cp} -pdR %s/* $RPM_BUILD_ROOT/%s || :\n",
+					stagedPath, filedata.DestinationPath(),
 				)
 			}
 
 			if filedata.Source != DIR {
-				dirpath := path.Clean(filedata.Destination)
+				dirpath := path.Clean(filedata.DestinationPath())
 				buildrootDirectoryList[dirpath] = dirpath
 			}
 			continue
@@ -177,10 +222,7 @@ func processComponentFiles(sourceWriter source.Writer, component *spec.Component
 		// if filedata.Destination == "" {
 		// 	realPath = filepath.Join(sourceWriter.Path(), filedata.Source)
 		// }
-		destPath := filedata.Destination
-		if destPath == "" {
-			destPath = filedata.Source
-		}
+		destPath := filedata.DestinationPath()
 
 		// Antes el RPM copiaba, pero ahora lo hace el source,,, m,mhhh
 		// prepFileCommands += fmt.Sprintf("%%{__cp} -p -L ")
@@ -197,7 +239,7 @@ func processComponentFiles(sourceWriter source.Writer, component *spec.Component
 
 // BuildRpms builds the RPMs packages shelling out to rpmbuild
 func (di *defaultImplementation) BuildRpms(
-	_ context.Context, _ *build.Options, specPath string, sourceWriter source.Writer,
+	_ context.Context, _ *build.Options, specPath string, sourceWriter source.Writer, _ *spec.Manifest,
 ) (results build.Result, err error) {
 	// We'll shell out to rpmbuild and run this:
 	rpmProc := command.New(
@@ -246,12 +288,12 @@ func (di *defaultImplementation) CopySourceFiles(ctx context.Context, opts *buil
 	}
 
 	// Copy the main component paths
-	if err := sourceWriter.CopyPaths(ctx, opts.SourceReader, manifest.Component.Files); err != nil {
+	if err := sourceWriter.CopyPaths(ctx, opts.SourceReader, manifest.Component.SourceFiles()); err != nil {
 		return fmt.Errorf("copying main component files: %w", err)
 	}
 
 	for _, c := range manifest.Components {
-		if err := sourceWriter.CopyPaths(ctx, opts.SourceReader, c.Files); err != nil {
+		if err := sourceWriter.CopyPaths(ctx, opts.SourceReader, c.SourceFiles()); err != nil {
 			return fmt.Errorf("copying files from %q: %w", c.Name, err)
 		}
 	}
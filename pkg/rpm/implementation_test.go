@@ -37,8 +37,11 @@ func TestBuildRpmSpec(t *testing.T) {
 			License:     "Apache-2.0",
 			Summary:     "Test project",
 			Description: "Empty project to test",
-			Requires: []string{
-				"comp1", "comp2",
+			Requires: spec.Relations{
+				{Name: "comp1"}, {Name: "comp2"},
+			},
+			Conflicts: spec.Relations{
+				{Name: "test-legacy", Operator: "<", Version: "2.0"},
 			},
 			Files: []*spec.File{
 				{
@@ -53,6 +56,17 @@ func TestBuildRpmSpec(t *testing.T) {
 					Source:      "/testfile.txt",
 					Destination: "/testfile.txt",
 				},
+				{
+					Source:      "/test.conf",
+					Destination: "/etc/test.conf",
+					Type:        spec.FileTypeConfig,
+					NoReplace:   true,
+					NoVerify:    []string{"md5", "mtime"},
+				},
+				{
+					Destination: "/var/log/test.log",
+					Type:        spec.FileTypeGhost,
+				},
 			},
 		},
 		Components: []*spec.Component{
@@ -61,7 +75,11 @@ func TestBuildRpmSpec(t *testing.T) {
 				License:     "Apache-2.0",
 				Summary:     "Documentos del deste",
 				Description: "Documentos del programa este para que leas",
-				Requires:    []string{"man"},
+				Requires:    spec.Relations{{Name: "man"}},
+				Scripts: spec.Scripts{
+					PostInstall:   spec.Script{Inline: "mandb -q\n"},
+					PostUninstall: spec.Script{Inline: "#!/bin/bash\nmandb -q\n"},
+				},
 				Files: []*spec.File{
 					{
 						Source:      "docs",
@@ -76,6 +94,16 @@ func TestBuildRpmSpec(t *testing.T) {
 	require.NoError(t, err)
 	t.Logf("Spec file: %s", path)
 	require.FileExists(t, path)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "%post docs\nmandb -q\n")
+	require.Contains(t, string(data), "%postun docs -p /bin/bash\nmandb -q\n")
+	require.Contains(t, string(data), "Requires: comp1, comp2\n")
+	require.Contains(t, string(data), "Conflicts: test-legacy < 2.0\n")
+	require.Contains(t, string(data), "%config(noreplace) %verify(not md5 mtime) %attr(-, -, -)/etc/test.conf\n")
+	require.Contains(t, string(data), "%ghost %attr(-, -, -)/var/log/test.log\n")
+	require.Contains(t, string(data), "%attr(-, -, -)/testfile.txt\n")
 }
 
 func TestFindFiles(t *testing.T) {
@@ -0,0 +1,694 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package rpm
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // rpm still verifies the legacy SHA1 header digest
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"github.com/ulikunitz/xz"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+// Payload compressors supported by the native writer
+const (
+	CompressionXz   = "xz"
+	CompressionZstd = "zstd"
+)
+
+// Dependency sense flags
+const (
+	senseLess         = 1 << 1
+	senseGreater      = 1 << 2
+	senseEqual        = 1 << 3
+	sensePostTrans    = 1 << 5
+	sensePreTrans     = 1 << 7
+	senseInterp       = 1 << 8
+	senseScriptPre    = 1 << 9
+	senseScriptPost   = 1 << 10
+	senseScriptPreUn  = 1 << 11
+	senseScriptPostUn = 1 << 12
+	senseRpmlib       = 1 << 24
+)
+
+// File attribute flags
+const (
+	fileConfig    = 1 << 0
+	fileDoc       = 1 << 1
+	fileMissingOK = 1 << 3
+	fileNoReplace = 1 << 4
+	fileGhost     = 1 << 6
+	fileLicense   = 1 << 7
+)
+
+// verifyFlags are the bits of the attributes checked by rpm --verify
+var verifyFlags = map[string]int32{
+	"md5":   1 << 0,
+	"size":  1 << 1,
+	"link":  1 << 2,
+	"user":  1 << 3,
+	"group": 1 << 4,
+	"mtime": 1 << 5,
+	"mode":  1 << 6,
+	"rdev":  1 << 7,
+	"caps":  1 << 8,
+}
+
+// Unix file type bits stored in the header and the cpio payload
+const (
+	modeDir     = 0o040000
+	modeRegular = 0o100000
+	modeSymlink = 0o120000
+)
+
+const (
+	leadSize         = 96
+	leadSignatureV5  = 5
+	leadOSLinux      = 1
+	digestAlgoSHA256 = 8
+	noarch           = "noarch"
+)
+
+var leadMagic = []byte{0xed, 0xab, 0xee, 0xdb}
+
+// nativeImplementation writes RPM files directly from the staged build root
+// without shelling out to rpmbuild.
+type nativeImplementation struct {
+	defaultImplementation
+	compression string
+}
+
+// packageData is the data written to the header of a single rpm
+type packageData struct {
+	Name        string
+	Version     string
+	Release     string
+	Summary     string
+	Description string
+	License     string
+	URL         string
+	Requires    spec.Relations
+	Provides    spec.Relations
+	Conflicts   spec.Relations
+	Obsoletes   spec.Relations
+	Recommends  spec.Relations
+	Suggests    spec.Relations
+	Supplements spec.Relations
+	Scripts     *spec.Scripts
+	Entries     []*staging.Entry
+}
+
+// scriptletTags are the header tags and the dependency flags of the
+// interpreter of each scriptlet section
+var scriptletTags = map[string]struct {
+	script, prog, sense int32
+}{
+	"pretrans":  {tagPreTrans, tagPreTransProg, sensePreTrans},
+	"pre":       {tagPreIn, tagPreInProg, senseScriptPre},
+	"post":      {tagPostIn, tagPostInProg, senseScriptPost},
+	"preun":     {tagPreUn, tagPreUnProg, senseScriptPreUn},
+	"postun":    {tagPostUn, tagPostUnProg, senseScriptPostUn},
+	"posttrans": {tagPostTrans, tagPostTransProg, sensePostTrans},
+}
+
+// BuildRpmSpec does not write a spec file as the native writer reads the
+// manifest directly. It only checks that the manifest can be packaged.
+func (ni *nativeImplementation) BuildRpmSpec(
+	_ context.Context, _ *build.Options, _ source.Writer, manifest *spec.Manifest,
+) (string, error) {
+	if len(manifest.Files) == 0 {
+		return "", fmt.Errorf("unable to build rpm, no files defined in top level project")
+	}
+	return "", nil
+}
+
+// BuildRpms writes an RPM file for the main component and one for each
+// of the subcomponents that has files.
+func (ni *nativeImplementation) BuildRpms(
+	ctx context.Context, opts *build.Options, _ string, sourceWriter source.Writer, manifest *spec.Manifest,
+) (results build.Result, err error) {
+	results = build.Result{Artifacts: []build.Artifact{}}
+
+	ver, err := staging.ResolveVersion(ctx, opts)
+	if err != nil {
+		return results, fmt.Errorf("resolving package version: %w", err)
+	}
+	rpmVersion := version.TranslateRPM(ver.String)
+
+	url := manifest.URL
+	if url == "" {
+		url = DefaultDownloadURL
+	}
+
+	for i, c := range append([]*spec.Component{&manifest.Component}, manifest.Components...) {
+		name := manifest.Name
+		if i > 0 {
+			if len(c.Files) == 0 {
+				logrus.Infof("Component %s not rpmfied because it does not provide any files", c.Name)
+				continue
+			}
+			name = fmt.Sprintf("%s-%s", manifest.Name, c.Name)
+		}
+
+		entries, err := staging.Collect(sourceWriter.Path(), c)
+		if err != nil {
+			return results, fmt.Errorf("reading files of %s: %w", name, err)
+		}
+
+		rpmPath := filepath.Join(
+			opts.OutputDir, fmt.Sprintf("%s-%s-%s.%s.rpm", name, rpmVersion, ver.Release, noarch),
+		)
+		if err := ni.writeRpm(rpmPath, &packageData{
+			Name:        name,
+			Version:     rpmVersion,
+			Release:     ver.Release,
+			Summary:     c.Summary,
+			Description: c.Description,
+			License:     c.License,
+			URL:         url,
+			Requires:    c.Requires,
+			Provides:    c.Provides,
+			Conflicts:   c.Conflicts,
+			Obsoletes:   c.Obsoletes,
+			Recommends:  c.Recommends,
+			Suggests:    c.Suggests,
+			Supplements: c.Supplements,
+			Scripts:     &c.Scripts,
+			Entries:     entries,
+		}); err != nil {
+			return results, fmt.Errorf("writing %s: %w", name, err)
+		}
+		logrus.Infof("Wrote: %s", rpmPath)
+		results.Artifacts = append(results.Artifacts, build.NewFileArtifact(rpmPath))
+	}
+	return results, nil
+}
+
+// writeRpm writes an rpm file to path. The payload is compressed to a
+// temporary file first as the signature needs to know its size and the
+// header needs the digests of the files.
+func (ni *nativeImplementation) writeRpm(rpmPath string, pkg *packageData) error {
+	payloadFile, err := os.CreateTemp("", "baggr-rpm-payload-*")
+	if err != nil {
+		return fmt.Errorf("creating payload file: %w", err)
+	}
+	defer func() {
+		payloadFile.Close()
+		os.Remove(payloadFile.Name())
+	}()
+
+	digests, payloadSize, err := ni.writePayload(payloadFile, pkg.Entries)
+	if err != nil {
+		return fmt.Errorf("writing payload: %w", err)
+	}
+
+	payloadInfo, err := payloadFile.Stat()
+	if err != nil {
+		return fmt.Errorf("reading payload size: %w", err)
+	}
+
+	hdr, err := ni.buildHeader(pkg, digests).Bytes()
+	if err != nil {
+		return fmt.Errorf("building header: %w", err)
+	}
+
+	sig, err := buildSignature(hdr, payloadInfo.Size(), payloadSize).Bytes()
+	if err != nil {
+		return fmt.Errorf("building signature: %w", err)
+	}
+
+	f, err := os.Create(rpmPath)
+	if err != nil {
+		return fmt.Errorf("creating rpm file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(buildLead(fmt.Sprintf("%s-%s-%s", pkg.Name, pkg.Version, pkg.Release))); err != nil {
+		return fmt.Errorf("writing lead: %w", err)
+	}
+
+	// The signature is padded to an 8 byte boundary
+	if n := len(sig) % 8; n != 0 {
+		sig = append(sig, make([]byte, 8-n)...)
+	}
+	if _, err := f.Write(sig); err != nil {
+		return fmt.Errorf("writing signature: %w", err)
+	}
+
+	if _, err := f.Write(hdr); err != nil {
+		return fmt.Errorf("writing header: %w", err)
+	}
+
+	if _, err := payloadFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewinding payload: %w", err)
+	}
+	if _, err := io.Copy(f, payloadFile); err != nil {
+		return fmt.Errorf("copying payload: %w", err)
+	}
+	return f.Close()
+}
+
+// writePayload writes the compressed cpio archive to w and returns the
+// file digests and the uncompressed size of the archive.
+func (ni *nativeImplementation) writePayload(w io.Writer, entries []*staging.Entry) (digests []string, size int64, err error) {
+	var cw io.WriteCloser
+	switch ni.compressor() {
+	case CompressionXz:
+		cw, err = xz.NewWriter(w)
+	case CompressionZstd:
+		cw, err = zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	default:
+		err = fmt.Errorf("unsupported payload compression %q", ni.compression)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("creating compressor: %w", err)
+	}
+
+	archive := newCpioWriter(cw)
+	digests = make([]string, len(entries))
+	inodes, nlinks := fileInodes(entries)
+	pending := maps.Clone(nlinks)
+	for i, e := range entries {
+		if e.Is(spec.FileTypeGhost) {
+			continue
+		}
+		hdr := &cpioHeader{
+			Inode: int(inodes[i]),
+			Mode:  unixMode(e.Mode),
+			UID:   e.UID,
+			GID:   e.GID,
+			Nlink: nlinks[inodes[i]],
+			MTime: e.ModTime.Unix(),
+			Name:  "." + e.Path,
+		}
+
+		// The data of hard links is stored with the last entry of the set
+		pending[inodes[i]]--
+		hasData := e.Mode.IsRegular() && pending[inodes[i]] == 0
+		switch {
+		case e.IsDir():
+			hdr.Nlink = 2
+		case e.IsSymlink() || hasData:
+			hdr.FileSize = e.Size
+		}
+
+		if err := archive.WriteHeader(hdr); err != nil {
+			return nil, 0, err
+		}
+
+		switch {
+		case e.IsSymlink():
+			if _, err := io.WriteString(archive, e.Linkname); err != nil {
+				return nil, 0, fmt.Errorf("writing link target: %w", err)
+			}
+		case hasData:
+			digest, err := copyEntry(archive, e)
+			if err != nil {
+				return nil, 0, err
+			}
+			digests[i] = digest
+		case e.Mode.IsRegular():
+			if digests[i], err = e.Digest(sha256.New()); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if err := archive.EndFile(); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, 0, err
+	}
+	if err := cw.Close(); err != nil {
+		return nil, 0, fmt.Errorf("closing compressor: %w", err)
+	}
+	return digests, archive.Len(), nil
+}
+
+// fileInodes returns the inode number of each entry and the number of
+// entries that share each inode. Hard links share the inode of the first
+// entry of their set.
+func fileInodes(entries []*staging.Entry) (inodes []int32, nlinks map[int32]int) {
+	inodes = make([]int32, len(entries))
+	nlinks = map[int32]int{}
+	byPath := map[string]int32{}
+	for i, e := range entries {
+		inodes[i] = int32(i + 1)
+		if e.IsHardlink() {
+			inodes[i] = byPath[e.Linkname]
+		}
+		byPath[e.Path] = inodes[i]
+		nlinks[inodes[i]]++
+	}
+	return inodes, nlinks
+}
+
+// copyEntry copies the staged file data to w and returns its sha256 digest
+func copyEntry(w io.Writer, e *staging.Entry) (string, error) {
+	f, err := e.Open()
+	if err != nil {
+		return "", fmt.Errorf("opening staged file: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), f)
+	if err != nil {
+		return "", fmt.Errorf("copying %s: %w", e.Path, err)
+	}
+	if n != e.Size {
+		return "", fmt.Errorf("%s changed size while building the payload", e.Path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (ni *nativeImplementation) compressor() string {
+	if ni.compression == "" {
+		return CompressionXz
+	}
+	return ni.compression
+}
+
+// buildHeader builds the main header of the package
+func (ni *nativeImplementation) buildHeader(pkg *packageData, digests []string) *header {
+	h := newHeader(tagHeaderImmutable)
+	h.addStringArray(tagHeaderI18NTable, []string{"C"})
+	h.addString(tagName, pkg.Name)
+	h.addString(tagVersion, pkg.Version)
+	h.addString(tagRelease, pkg.Release)
+	h.addI18NString(tagSummary, pkg.Summary)
+	h.addI18NString(tagDescription, pkg.Description)
+	h.addInt32(tagBuildTime, int32(time.Now().Unix()))
+	h.addString(tagBuildHost, buildHost())
+	h.addString(tagLicense, pkg.License)
+	h.addI18NString(tagGroup, "Unspecified")
+	h.addString(tagURL, pkg.URL)
+	h.addString(tagOS, "linux")
+	h.addString(tagArch, noarch)
+	h.addString(tagSourceRPM, fmt.Sprintf("%s-%s-%s.src.rpm", pkg.Name, pkg.Version, pkg.Release))
+	h.addString(tagRPMVersion, "4.16.0")
+	h.addString(tagPayloadFormat, "cpio")
+	h.addString(tagPayloadCompressor, ni.compressor())
+	if ni.compressor() == CompressionZstd {
+		h.addString(tagPayloadFlags, "19")
+	} else {
+		h.addString(tagPayloadFlags, "6")
+	}
+
+	// Every package provides itself
+	provides := append([]dependency{{
+		name: pkg.Name, sense: senseEqual, version: fmt.Sprintf("%s-%s", pkg.Version, pkg.Release),
+	}}, dependencies(pkg.Provides)...)
+	addDependencies(h, provideTags, provides)
+	addDependencies(h, conflictTags, dependencies(pkg.Conflicts))
+	addDependencies(h, obsoleteTags, dependencies(pkg.Obsoletes))
+	addDependencies(h, recommendTags, dependencies(pkg.Recommends))
+	addDependencies(h, suggestTags, dependencies(pkg.Suggests))
+	addDependencies(h, supplementTags, dependencies(pkg.Supplements))
+
+	requires := dependencies(pkg.Requires)
+	if pkg.Scripts != nil {
+		for _, s := range scriptlets(pkg.Scripts) {
+			if !s.script.Defined() {
+				continue
+			}
+			tags := scriptletTags[s.section]
+			h.addString(tags.script, s.script.Body())
+			prog := strings.Fields(s.script.Interpreter())
+			h.addStringArray(tags.prog, prog)
+			requires = append(requires, dependency{name: prog[0], sense: senseInterp | tags.sense})
+		}
+	}
+	addRequires(h, requires, ni.compressor())
+
+	if len(pkg.Entries) == 0 {
+		h.addInt32(tagSize, 0)
+		return h
+	}
+
+	var (
+		total                       int64
+		sizes, mtimes, flags        = []int32{}, []int32{}, []int32{}
+		devices, dirIndexes         = []int32{}, []int32{}
+		modes, rdevs                = []int16{}, []int16{}
+		verifies                    = []int32{}
+		users, groups, links, langs = []string{}, []string{}, []string{}, []string{}
+		baseNames, dirNames         = []string{}, []string{}
+		dirIndex                    = map[string]int32{}
+	)
+	inodes, _ := fileInodes(pkg.Entries)
+	for _, e := range pkg.Entries {
+		// Files are at most 4 GiB, the cpio payload can't hold larger ones
+		size := e.Size
+		if e.IsDir() {
+			size = 4096
+		} else if !e.IsHardlink() {
+			total += size
+		}
+		sizes = append(sizes, int32(uint32(size)))
+		mtimes = append(mtimes, int32(e.ModTime.Unix()))
+		fileFlags, verify := fileAttributes(e)
+		flags = append(flags, fileFlags)
+		verifies = append(verifies, verify)
+		devices = append(devices, 1)
+		modes = append(modes, int16(unixMode(e.Mode)))
+		rdevs = append(rdevs, 0)
+		users = append(users, e.Owner)
+		groups = append(groups, e.Group)
+		link := ""
+		if e.IsSymlink() {
+			link = e.Linkname
+		}
+		links = append(links, link)
+		langs = append(langs, "")
+
+		dir := strings.TrimSuffix(path.Dir(e.Path), "/") + "/"
+		if _, ok := dirIndex[dir]; !ok {
+			dirIndex[dir] = int32(len(dirNames))
+			dirNames = append(dirNames, dir)
+		}
+		dirIndexes = append(dirIndexes, dirIndex[dir])
+		baseNames = append(baseNames, path.Base(e.Path))
+	}
+
+	h.addSize(tagSize, tagLongSize, total)
+	h.addInt32(tagFileSizes, sizes...)
+	h.addInt16(tagFileModes, modes...)
+	h.addInt16(tagFileRDevs, rdevs...)
+	h.addInt32(tagFileMTimes, mtimes...)
+	h.addStringArray(tagFileDigests, digests)
+	h.addStringArray(tagFileLinkTos, links)
+	h.addInt32(tagFileFlags, flags...)
+	h.addInt32(tagFileVerifyFlags, verifies...)
+	h.addStringArray(tagFileUserName, users)
+	h.addStringArray(tagFileGroupName, groups)
+	h.addInt32(tagFileDevices, devices...)
+	h.addInt32(tagFileInodes, inodes...)
+	h.addStringArray(tagFileLangs, langs)
+	h.addInt32(tagDirIndexes, dirIndexes...)
+	h.addStringArray(tagBaseNames, baseNames)
+	h.addStringArray(tagDirNames, dirNames)
+	h.addInt32(tagFileDigestAlgo, digestAlgoSHA256)
+	return h
+}
+
+// fileAttributes returns the file flags and the verify flags of an entry
+// from the type of the manifest file it was collected from
+func fileAttributes(e *staging.Entry) (flags, verify int32) {
+	verify = -1
+	if e.File == nil {
+		return 0, verify
+	}
+	switch e.File.Type {
+	case spec.FileTypeConfig:
+		flags = fileConfig
+		if e.File.NoReplace {
+			flags |= fileNoReplace
+		}
+		if e.File.MissingOK {
+			flags |= fileMissingOK
+		}
+	case spec.FileTypeDoc:
+		flags = fileDoc
+	case spec.FileTypeLicense:
+		flags = fileLicense
+	case spec.FileTypeGhost:
+		// The contents of ghost files are not shipped, like rpmbuild
+		// we don't verify them
+		flags = fileGhost
+		verify &^= verifyFlags["md5"] | verifyFlags["size"] | verifyFlags["link"] | verifyFlags["mtime"]
+	}
+	for _, a := range e.File.NoVerify {
+		verify &^= verifyFlags[a]
+	}
+	return flags, verify
+}
+
+// dependency is an entry in the requires of a package
+type dependency struct {
+	name    string
+	sense   int32
+	version string
+}
+
+// relationTags are the name, flags and version tags of a kind of
+// dependency
+type relationTags struct {
+	name, flags, version int32
+}
+
+var (
+	requireTags    = relationTags{tagRequireName, tagRequireFlags, tagRequireVersion}
+	provideTags    = relationTags{tagProvideName, tagProvideFlags, tagProvideVersion}
+	conflictTags   = relationTags{tagConflictName, tagConflictFlags, tagConflictVersion}
+	obsoleteTags   = relationTags{tagObsoleteName, tagObsoleteFlags, tagObsoleteVersion}
+	recommendTags  = relationTags{tagRecommendName, tagRecommendFlags, tagRecommendVersion}
+	suggestTags    = relationTags{tagSuggestName, tagSuggestFlags, tagSuggestVersion}
+	supplementTags = relationTags{tagSupplementName, tagSupplementFlags, tagSupplementVersion}
+)
+
+// addDependencies writes a list of dependencies to the header, it does
+// nothing if the list is empty
+func addDependencies(h *header, tags relationTags, deps []dependency) {
+	if len(deps) == 0 {
+		return
+	}
+	names, versions, flags := []string{}, []string{}, []int32{}
+	for _, d := range deps {
+		names = append(names, d.name)
+		flags = append(flags, d.sense)
+		versions = append(versions, d.version)
+	}
+	h.addStringArray(tags.name, names)
+	h.addInt32(tags.flags, flags...)
+	h.addStringArray(tags.version, versions)
+}
+
+// addRequires adds the package dependencies and the rpmlib features
+// needed to install the package
+func addRequires(h *header, requires []dependency, compression string) {
+	features := [][2]string{
+		{"rpmlib(CompressedFileNames)", "3.0.4-1"},
+		{"rpmlib(FileDigests)", "4.6.0-1"},
+		{"rpmlib(PayloadFilesHavePrefix)", "4.0-1"},
+	}
+	if compression == CompressionZstd {
+		features = append(features, [2]string{"rpmlib(PayloadIsZstd)", "5.4.18-1"})
+	} else {
+		features = append(features, [2]string{"rpmlib(PayloadIsXz)", "5.2-1"})
+	}
+	for _, f := range features {
+		requires = append(requires, dependency{
+			name: f[0], sense: senseRpmlib | senseLess | senseEqual, version: f[1],
+		})
+	}
+	addDependencies(h, requireTags, requires)
+}
+
+// dependencies converts the relations in the manifest to header
+// dependencies
+func dependencies(rels spec.Relations) []dependency {
+	res := []dependency{}
+	for _, r := range rels {
+		res = append(res, newDependency(r))
+	}
+	return res
+}
+
+// newDependency returns the header dependency of a relation, translating
+// its operator to the sense flags
+func newDependency(r spec.Relation) dependency {
+	var sense int32
+	switch r.Operator {
+	case spec.OpLess:
+		sense = senseLess
+	case spec.OpLessOrEqual:
+		sense = senseLess | senseEqual
+	case spec.OpEqual:
+		sense = senseEqual
+	case spec.OpGreaterOrEqual:
+		sense = senseGreater | senseEqual
+	case spec.OpGreater:
+		sense = senseGreater
+	}
+	return dependency{name: r.Name, sense: sense, version: r.Version}
+}
+
+// buildSignature builds the signature header from the main header and
+// the sizes of the payload.
+func buildSignature(hdr []byte, compressedSize, payloadSize int64) *header {
+	h := newHeader(tagHeaderSignatures)
+	sha1sum := sha1.Sum(hdr) //nolint:gosec // legacy header digest
+	sha256sum := sha256.Sum256(hdr)
+	h.addString(sigTagSHA1, hex.EncodeToString(sha1sum[:]))
+	h.addString(sigTagSHA256, hex.EncodeToString(sha256sum[:]))
+	h.addSize(sigTagSize, sigTagLongSize, int64(len(hdr))+compressedSize)
+	h.addSize(sigTagPayloadSize, sigTagLongArchiveSize, payloadSize)
+	return h
+}
+
+// buildLead returns the legacy 96 byte lead that starts every rpm file
+func buildLead(name string) []byte {
+	lead := make([]byte, leadSize)
+	copy(lead, leadMagic)
+	lead[4] = 3 // Major version
+	lead[5] = 0 // Minor version
+	// Type (binary) and architecture are left as zero
+	copy(lead[10:75], name)
+	binary.BigEndian.PutUint16(lead[76:], leadOSLinux)
+	binary.BigEndian.PutUint16(lead[78:], leadSignatureV5)
+	return lead
+}
+
+// unixMode converts a go file mode to the unix mode stored in rpms
+func unixMode(m fs.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&fs.ModeSetuid != 0 {
+		mode |= 0o4000
+	}
+	if m&fs.ModeSetgid != 0 {
+		mode |= 0o2000
+	}
+	if m&fs.ModeSticky != 0 {
+		mode |= 0o1000
+	}
+	switch {
+	case m.IsDir():
+		mode |= modeDir
+	case m&fs.ModeSymlink != 0:
+		mode |= modeSymlink
+	default:
+		mode |= modeRegular
+	}
+	return mode
+}
+
+func buildHost() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "localhost"
+	}
+	return host
+}
@@ -0,0 +1,232 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package rpm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/require"
+	"github.com/ulikunitz/xz"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/staging"
+	"github.com/uservers/baggr/pkg/staging/stagingtest"
+)
+
+// readTestHeader reads a header structure and returns its string tags and
+// its size in bytes
+func readTestHeader(t *testing.T, r io.Reader) (tags map[int32][]string, length int) {
+	t.Helper()
+	intro := make([]byte, 16)
+	_, err := io.ReadFull(r, intro)
+	require.NoError(t, err)
+	require.Equal(t, headerMagic, intro[:8])
+	count := binary.BigEndian.Uint32(intro[8:])
+	size := binary.BigEndian.Uint32(intro[12:])
+
+	index := make([]int32, count*4)
+	require.NoError(t, binary.Read(r, binary.BigEndian, index))
+	store := make([]byte, size)
+	_, err = io.ReadFull(r, store)
+	require.NoError(t, err)
+
+	res := map[int32][]string{}
+	for i := 0; i < int(count); i++ {
+		tag, typ, offset, n := index[i*4], index[i*4+1], index[i*4+2], index[i*4+3]
+		switch typ {
+		case typeString, typeI18NString, typeStringArray:
+			res[tag] = strings.Split(string(store[offset:]), "\x00")[:n]
+		}
+	}
+	return res, 16 + len(index)*4 + len(store)
+}
+
+func TestNativeBuildRpms(t *testing.T) {
+	t.Parallel()
+	ctx := stagingtest.Context("1.0.0", "1")
+	swTemp := stagingtest.Dir(t, map[string]string{"etc/test.conf": "debug=0\n", "docs/index.html": "hey"})
+	require.NoError(t, os.Symlink("test", filepath.Join(swTemp, "usr", "bin", "test-link")))
+	require.NoError(t, os.Link(filepath.Join(swTemp, "usr", "bin", "test"), filepath.Join(swTemp, "usr", "bin", "test2")))
+
+	man := stagingtest.Manifest(
+		&spec.File{Source: spec.DirSource, Destination: "/var/lib/test"},
+		&spec.File{Source: "etc/test.conf", Destination: "/etc/test.conf", Type: spec.FileTypeConfig, NoReplace: true},
+		&spec.File{Destination: "/var/log/test.log", Type: spec.FileTypeGhost},
+		&spec.File{Destination: "/usr/bin/test-link", Type: spec.FileTypeSymlink, Target: "test"},
+		&spec.File{Destination: "/usr/bin/test2", Type: spec.FileTypeHardlink, Target: "/usr/bin/test"},
+	)
+	man.License = "Apache-2.0"
+	man.Requires = spec.Relations{{Name: "bash", Operator: ">=", Version: "4.0"}, {Name: "coreutils"}}
+	man.Provides = spec.Relations{{Name: "test-tools", Operator: "=", Version: "1.0.0"}}
+	man.Obsoletes = spec.Relations{{Name: "old-test", Operator: "<", Version: "1.0"}}
+	man.Recommends = spec.Relations{{Name: "test-docs"}}
+	man.Scripts = spec.Scripts{
+		PostInstall:  spec.Script{Inline: "systemctl daemon-reload\n"},
+		PreUninstall: spec.Script{Inline: "#!/usr/bin/python3\nprint('bye')\n"},
+	}
+	man.Components = []*spec.Component{
+		{Name: "docs", Files: []*spec.File{{Source: "docs", Destination: "/docs"}}},
+		{Name: "empty"},
+	}
+
+	for _, tc := range []struct {
+		compression string
+		decompress  func(io.Reader) (io.Reader, error)
+	}{
+		{CompressionXz, func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) }},
+		{CompressionZstd, func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }},
+	} {
+		t.Run(tc.compression, func(t *testing.T) {
+			t.Parallel()
+			ni := &nativeImplementation{compression: tc.compression}
+			res, err := ni.BuildRpms(ctx, &build.Options{OutputDir: t.TempDir()}, "", source.NewDirWriter(swTemp), man)
+			require.NoError(t, err)
+			require.Len(t, res.Artifacts, 2)
+
+			f, err := os.Open(res.Artifacts[0].Path())
+			require.NoError(t, err)
+			defer f.Close()
+			r := bufio.NewReader(f)
+
+			lead := make([]byte, leadSize)
+			_, err = io.ReadFull(r, lead)
+			require.NoError(t, err)
+			require.Equal(t, leadMagic, lead[:4])
+
+			// The signature header is padded to 8 bytes
+			sig, sigLen := readTestHeader(t, r)
+			require.Len(t, sig[sigTagSHA256], 1)
+			if n := sigLen % 8; n != 0 {
+				_, err := r.Discard(8 - n)
+				require.NoError(t, err)
+			}
+
+			hdr, _ := readTestHeader(t, r)
+			require.Equal(t, []string{"test"}, hdr[tagName])
+			require.Equal(t, []string{"1.0.0"}, hdr[tagVersion])
+			require.Equal(t, []string{tc.compression}, hdr[tagPayloadCompressor])
+			require.Equal(t, []string{"test.conf", "test", "test-link", "test2", "test", "test.log"}, hdr[tagBaseNames])
+			require.Equal(t, []string{"", "", "test", "", "", ""}, hdr[tagFileLinkTos])
+			require.Equal(t, []string{"/etc/", "/usr/bin/", "/var/lib/", "/var/log/"}, hdr[tagDirNames])
+			require.Contains(t, hdr[tagRequireName], "bash")
+			require.Contains(t, hdr[tagRequireName], "/bin/sh")
+			require.Contains(t, hdr[tagRequireName], "/usr/bin/python3")
+			require.Equal(t, []string{"test", "test-tools"}, hdr[tagProvideName])
+			require.Equal(t, []string{"1.0.0-1", "1.0.0"}, hdr[tagProvideVersion])
+			require.Equal(t, []string{"old-test"}, hdr[tagObsoleteName])
+			require.Equal(t, []string{"1.0"}, hdr[tagObsoleteVersion])
+			require.Equal(t, []string{"test-docs"}, hdr[tagRecommendName])
+			require.NotContains(t, hdr, int32(tagConflictName))
+			require.Equal(t, []string{"systemctl daemon-reload\n"}, hdr[tagPostIn])
+			require.Equal(t, []string{"/bin/sh"}, hdr[tagPostInProg])
+			require.Equal(t, []string{"print('bye')\n"}, hdr[tagPreUn])
+			require.Equal(t, []string{"/usr/bin/python3"}, hdr[tagPreUnProg])
+			require.NotContains(t, hdr, int32(tagPreIn))
+
+			payload, err := tc.decompress(r)
+			require.NoError(t, err)
+			data, err := io.ReadAll(payload)
+			require.NoError(t, err)
+			require.True(t, bytes.HasPrefix(data, []byte(cpioMagic)))
+			require.Contains(t, string(data), "./usr/bin/test\x00")
+			require.Contains(t, string(data), "./etc/test.conf\x00")
+			require.Equal(t, 1, strings.Count(string(data), "#!/bin/sh\n"))
+			require.NotContains(t, string(data), "./var/log/test.log\x00")
+			require.Contains(t, string(data), cpioTrailer)
+		})
+	}
+}
+
+func TestFileAttributes(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		file   *spec.File
+		flags  int32
+		verify int32
+	}{
+		{nil, 0, -1},
+		{&spec.File{}, 0, -1},
+		{&spec.File{Type: spec.FileTypeConfig}, fileConfig, -1},
+		{&spec.File{Type: spec.FileTypeConfig, NoReplace: true, MissingOK: true}, fileConfig | fileNoReplace | fileMissingOK, -1},
+		{&spec.File{Type: spec.FileTypeDoc}, fileDoc, -1},
+		{&spec.File{Type: spec.FileTypeLicense, NoVerify: []string{"mtime"}}, fileLicense, ^int32(1 << 5)},
+		{&spec.File{Type: spec.FileTypeGhost}, fileGhost, ^int32(1<<0 | 1<<1 | 1<<2 | 1<<5)},
+		{&spec.File{Type: spec.FileTypeDir, NoVerify: []string{"user", "group"}}, 0, ^int32(1<<3 | 1<<4)},
+	} {
+		flags, verify := fileAttributes(&staging.Entry{File: tc.file})
+		require.Equal(t, tc.flags, flags)
+		require.Equal(t, tc.verify, verify)
+	}
+}
+
+func TestFileInodes(t *testing.T) {
+	t.Parallel()
+	inodes, nlinks := fileInodes([]*staging.Entry{
+		{Path: "/a"},
+		{Path: "/b", Linkname: "/a"},
+		{Path: "/c", Mode: fs.ModeSymlink, Linkname: "a"},
+		{Path: "/d", Linkname: "/a"},
+	})
+	require.Equal(t, []int32{1, 1, 3, 1}, inodes)
+	require.Equal(t, map[int32]int{1: 3, 3: 1}, nlinks)
+}
+
+func TestNewDependency(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		dep   string
+		name  string
+		sense int32
+		ver   string
+	}{
+		{"bash", "bash", 0, ""},
+		{"perl >= 5.00502", "perl", senseGreater | senseEqual, "5.00502"},
+		{"glibc < 2.0", "glibc", senseLess, "2.0"},
+		{"foo = 1:2.0-1", "foo", senseEqual, "1:2.0-1"},
+		{"foo<=2", "foo", senseLess | senseEqual, "2"},
+	} {
+		rel, err := spec.ParseRelation(tc.dep)
+		require.NoError(t, err)
+		dep := newDependency(rel)
+		require.Equal(t, tc.name, dep.name)
+		require.Equal(t, tc.sense, dep.sense)
+		require.Equal(t, tc.ver, dep.version)
+	}
+}
+
+func TestBuildSignatureSizes(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name                  string
+		compressed, payload   int64
+		sizeTag, payloadTag   int32
+		sizeData, payloadData []byte
+	}{
+		{"small", 100, 200, sigTagSize, sigTagPayloadSize, []byte{0, 0, 0, 110}, []byte{0, 0, 0, 200}},
+		{"unsigned", 3 << 30, 3 << 30, sigTagSize, sigTagPayloadSize, []byte{0xc0, 0, 0, 10}, []byte{0xc0, 0, 0, 0}},
+		{"long", 5 << 30, 6 << 30, sigTagLongSize, sigTagLongArchiveSize, []byte{0, 0, 0, 1, 0x40, 0, 0, 10}, []byte{0, 0, 0, 1, 0x80, 0, 0, 0}},
+	} {
+		h := buildSignature(make([]byte, 10), tc.compressed, tc.payload)
+		require.Equal(t, tc.sizeData, h.entries[tc.sizeTag].data, tc.name)
+		require.Equal(t, tc.payloadData, h.entries[tc.payloadTag].data, tc.name)
+		if tc.sizeTag == sigTagLongSize {
+			require.NotContains(t, h.entries, int32(sigTagSize), tc.name)
+			require.Equal(t, int32(typeInt64), h.entries[tc.sizeTag].dataType, tc.name)
+		}
+	}
+
+	// Files that don't fit in the cpio payload are an error
+	err := newCpioWriter(io.Discard).WriteHeader(&cpioHeader{Name: "./big", FileSize: 5 << 30})
+	require.Error(t, err)
+}
@@ -7,31 +7,74 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/release-utils/command"
+
 	"github.com/uservers/baggr/pkg/build"
 	"github.com/uservers/baggr/pkg/source"
 	"github.com/uservers/baggr/pkg/spec"
 )
 
 const (
-	DIR = "%DIR%"
+	DIR = spec.DirSource
+)
+
+// Backends that can be used to build the RPM files
+const (
+	// BackendAuto uses rpmbuild when installed, native otherwise
+	BackendAuto = "auto"
+
+	// BackendRpmbuild writes a spec file and shells out to rpmbuild
+	BackendRpmbuild = "rpmbuild"
+
+	// BackendNative writes the RPM files directly
+	BackendNative = "native"
 )
 
 //go:embed template/spec.tmpl
 var Template string
 
+// New returns a new RPM worker. The implementation is chosen for each
+// build from the backend set in the options.
 func New() *Worker {
-	return &Worker{
-		implementation: &defaultImplementation{},
-	}
+	return &Worker{}
 }
 
 type Worker struct {
 	implementation Implementation
 }
 
+// getImplementation returns the implementation for the backend in the
+// options unless the worker already has one set.
+func (w *Worker) getImplementation(opts *build.Options) (Implementation, error) {
+	if w.implementation != nil {
+		return w.implementation, nil
+	}
+
+	switch opts.RpmBackend {
+	case "", BackendAuto:
+		if command.Available("rpmbuild") {
+			return &defaultImplementation{}, nil
+		}
+		logrus.Info("rpmbuild not found, using native RPM writer")
+		return &nativeImplementation{compression: opts.RpmCompression}, nil
+	case BackendRpmbuild:
+		return &defaultImplementation{}, nil
+	case BackendNative:
+		return &nativeImplementation{compression: opts.RpmCompression}, nil
+	default:
+		return nil, fmt.Errorf("unknown rpm backend %q", opts.RpmBackend)
+	}
+}
+
 // BuildPackages takes a manifest and build the rpms defined in it
 func (w *Worker) BuildPackages(ctx context.Context, manifest *spec.Manifest, opts *build.Options) (build.Result, error) {
 	var results build.Result
+	impl, err := w.getImplementation(opts)
+	if err != nil {
+		return results, err
+	}
+
 	// Create a temp directory to use as the build root
 	tmp, err := os.MkdirTemp("", "baggr-rpmbuildroot-*")
 	if err != nil {
@@ -39,16 +82,16 @@ func (w *Worker) BuildPackages(ctx context.Context, manifest *spec.Manifest, opt
 	}
 	sourceWriter := source.NewDirWriter(tmp)
 
-	if err := w.implementation.CopySourceFiles(ctx, opts, sourceWriter, manifest); err != nil {
+	if err := impl.CopySourceFiles(ctx, opts, sourceWriter, manifest); err != nil {
 		return results, fmt.Errorf("copying package files: %w", err)
 	}
 
-	rpmSpecPath, err := w.implementation.BuildRpmSpec(ctx, opts, sourceWriter, manifest)
+	rpmSpecPath, err := impl.BuildRpmSpec(ctx, opts, sourceWriter, manifest)
 	if err != nil {
 		return results, fmt.Errorf("building RPM spec: %w", err)
 	}
 
-	results, err = w.implementation.BuildRpms(ctx, opts, rpmSpecPath, sourceWriter)
+	results, err = impl.BuildRpms(ctx, opts, rpmSpecPath, sourceWriter, manifest)
 	if err != nil {
 		return results, fmt.Errorf("packaging RPMs: %w", err)
 	}
@@ -0,0 +1,343 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// ArchiveReader is a source reader that reads the files from a tar or zip
+// archive, or from the payload of rpm and deb packages. The archive is
+// loaded in memory and read with the filesystem reader, so paths work as
+// in a directory with the archive contents.
+type ArchiveReader struct {
+	*FilesystemReader
+
+	// Path is the path of the archive file
+	Path string
+}
+
+// NewArchiveReader loads the archive at path. Tar archives and package
+// payloads can be compressed with gzip, xz, zstd or bzip2. The first strip
+// elements of the paths in the archive are removed, as with tar
+// --strip-components.
+func NewArchiveReader(p string, strip int) (*ArchiveReader, error) {
+	if strip < 0 {
+		return nil, fmt.Errorf("invalid number of components to strip: %d", strip)
+	}
+	afs := newArchiveFS()
+	var err error
+	switch archiveFormat(p) {
+	case "zip":
+		err = afs.loadZip(p, strip)
+	case "tar":
+		err = afs.loadTar(p, strip)
+	case "rpm":
+		err = afs.loadRPM(p, strip)
+	case "deb":
+		err = afs.loadDeb(p, strip)
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s", p)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading archive %s: %w", p, err)
+	}
+	return &ArchiveReader{FilesystemReader: NewFilesystemReader(afs), Path: p}, nil
+}
+
+// archiveFormat returns the format of an archive from its name: zip, tar,
+// rpm or deb, or an empty string if it is not an archive
+func archiveFormat(p string) string {
+	name := strings.ToLower(p)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar"), strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"),
+		strings.HasSuffix(name, ".tar.xz"), strings.HasSuffix(name, ".txz"),
+		strings.HasSuffix(name, ".tar.zst"), strings.HasSuffix(name, ".tzst"),
+		strings.HasSuffix(name, ".tar.bz2"), strings.HasSuffix(name, ".tbz2"):
+		return "tar"
+	case strings.HasSuffix(name, ".rpm"):
+		return "rpm"
+	case strings.HasSuffix(name, ".deb"):
+		return "deb"
+	}
+	return ""
+}
+
+// archiveFile is a file, directory or symbolic link in an archive
+type archiveFile struct {
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+	target  string
+}
+
+// archiveFS is a read only in-memory filesystem with the contents of an
+// archive. It follows the symbolic links like os.DirFS.
+type archiveFS struct {
+	files map[string]*archiveFile
+}
+
+func newArchiveFS() *archiveFS {
+	return &archiveFS{files: map[string]*archiveFile{
+		".": {mode: fs.ModeDir | 0o755},
+	}}
+}
+
+// stripPath cleans a path of the archive and removes its first elements.
+// It returns an empty string if nothing is left.
+func stripPath(name string, strip int) string {
+	elems := strings.Split(cleanPattern(name), "/")
+	if len(elems) <= strip || elems[0] == "" {
+		return ""
+	}
+	return strings.Join(elems[strip:], "/")
+}
+
+// add stores a file in the filesystem and creates its parent directories
+func (afs *archiveFS) add(name string, f *archiveFile) {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if _, ok := afs.files[dir]; ok {
+			break
+		}
+		afs.files[dir] = &archiveFile{mode: fs.ModeDir | 0o755, modTime: f.modTime}
+	}
+	afs.files[name] = f
+}
+
+func (afs *archiveFS) loadTar(p string, strip int) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return afs.loadTarStream(f, strip)
+}
+
+// decompress returns a reader of the data decompressed with the algorithm
+// detected from its magic bytes: gzip, xz, zstd or bzip2. Data not
+// compressed is returned as is. The returned function releases the
+// decompressor.
+func decompress(r io.Reader) (io.Reader, func(), error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(6)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("reading compression magic: %w", err)
+	}
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		return gr, func() { gr.Close() }, nil
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening xz stream: %w", err)
+		}
+		return xr, func() {}, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening zstd stream: %w", err)
+		}
+		return zr, zr.Close, nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br), func() {}, nil
+	}
+	return br, func() {}, nil
+}
+
+// loadTarStream loads the files of a tar stream, compressed or not
+func (afs *archiveFS) loadTarStream(stream io.Reader, strip int) error {
+	r, done, err := decompress(stream)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar entry: %w", err)
+		}
+		name := stripPath(hdr.Name, strip)
+		if name == "" {
+			continue
+		}
+		af := &archiveFile{mode: fs.FileMode(hdr.Mode).Perm(), modTime: hdr.ModTime}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			af.mode |= fs.ModeDir
+		case tar.TypeReg:
+			if af.data, err = io.ReadAll(tr); err != nil {
+				return fmt.Errorf("reading %s: %w", hdr.Name, err)
+			}
+		case tar.TypeSymlink:
+			af.mode = fs.ModeSymlink | 0o777
+			af.target = hdr.Linkname
+		case tar.TypeLink:
+			target, ok := afs.files[stripPath(hdr.Linkname, strip)]
+			if !ok || !target.mode.IsRegular() {
+				return fmt.Errorf("hard link %s points to a missing file", hdr.Name)
+			}
+			af.data = target.data
+		default:
+			continue
+		}
+		afs.add(name, af)
+	}
+}
+
+func (afs *archiveFS) loadZip(p string, strip int) error {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, zf := range zr.File {
+		name := stripPath(zf.Name, strip)
+		if name == "" {
+			continue
+		}
+		af := &archiveFile{mode: zf.Mode(), modTime: zf.Modified}
+		if !zf.Mode().IsDir() {
+			rc, err := zf.Open()
+			if err != nil {
+				return fmt.Errorf("opening %s: %w", zf.Name, err)
+			}
+			af.data, err = io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", zf.Name, err)
+			}
+		}
+		if zf.Mode()&fs.ModeSymlink != 0 {
+			af.target, af.data = string(af.data), nil
+		}
+		afs.add(name, af)
+	}
+	return nil
+}
+
+// lookup returns the file at name. When follow is set, symbolic links are
+// resolved inside the archive.
+func (afs *archiveFS) lookup(op, name string, follow bool) (string, *archiveFile, error) {
+	if !fs.ValidPath(name) {
+		return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	p := name
+	for range maxLinkDepth {
+		f, ok := afs.files[p]
+		if !ok {
+			return "", nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if !follow || f.mode&fs.ModeSymlink == 0 {
+			return p, f, nil
+		}
+		target := f.target
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(p), target)
+		}
+		if p = cleanPattern(target); p == "" {
+			p = "."
+		}
+	}
+	return "", nil, &fs.PathError{Op: op, Path: name, Err: errors.New("too many levels of links")}
+}
+
+// Open opens a file of the archive
+func (afs *archiveFS) Open(name string) (fs.File, error) {
+	p, f, err := afs.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveOpenFile{Reader: bytes.NewReader(f.data), info: &archiveFileInfo{path.Base(p), f}}, nil
+}
+
+// Stat returns the information of a file, following links
+func (afs *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	p, f, err := afs.lookup("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFileInfo{path.Base(p), f}, nil
+}
+
+// ReadLink returns the destination of a symbolic link
+func (afs *archiveFS) ReadLink(name string) (string, error) {
+	_, f, err := afs.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if f.mode&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return f.target, nil
+}
+
+// ReadDir returns the entries of a directory sorted by name
+func (afs *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, f, err := afs.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !f.mode.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+	res := []fs.DirEntry{}
+	for fp, f := range afs.files {
+		if fp != "." && path.Dir(fp) == p {
+			res = append(res, fs.FileInfoToDirEntry(&archiveFileInfo{path.Base(fp), f}))
+		}
+	}
+	slices.SortFunc(res, func(a, b fs.DirEntry) int { return strings.Compare(a.Name(), b.Name()) })
+	return res, nil
+}
+
+// archiveOpenFile is an open file of the archive
+type archiveOpenFile struct {
+	*bytes.Reader
+	info *archiveFileInfo
+}
+
+func (f *archiveOpenFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *archiveOpenFile) Close() error               { return nil }
+
+// archiveFileInfo is the fs.FileInfo of a file in the archive
+type archiveFileInfo struct {
+	name string
+	file *archiveFile
+}
+
+func (fi *archiveFileInfo) Name() string       { return fi.name }
+func (fi *archiveFileInfo) Size() int64        { return int64(len(fi.file.data)) }
+func (fi *archiveFileInfo) Mode() fs.FileMode  { return fi.file.mode }
+func (fi *archiveFileInfo) ModTime() time.Time { return fi.file.modTime }
+func (fi *archiveFileInfo) IsDir() bool        { return fi.file.mode.IsDir() }
+func (fi *archiveFileInfo) Sys() any           { return nil }
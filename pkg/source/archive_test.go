@@ -0,0 +1,129 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+var archiveModTime = time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+func writeTestTarGz(t *testing.T, p string) {
+	t.Helper()
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for _, hdr := range []*tar.Header{
+		{Typeflag: tar.TypeDir, Name: "tool-1.0/", Mode: 0o755},
+		{Typeflag: tar.TypeDir, Name: "tool-1.0/bin/", Mode: 0o755},
+		{Typeflag: tar.TypeReg, Name: "tool-1.0/bin/tool", Mode: 0o755, Size: 4},
+		{Typeflag: tar.TypeSymlink, Name: "tool-1.0/bin/tool-alias", Linkname: "tool"},
+		{Typeflag: tar.TypeLink, Name: "tool-1.0/bin/tool2", Linkname: "tool-1.0/bin/tool"},
+		{Typeflag: tar.TypeReg, Name: "tool-1.0/share/doc/README", Mode: 0o644, Size: 6},
+	} {
+		hdr.ModTime = archiveModTime
+		require.NoError(t, tw.WriteHeader(hdr))
+		switch hdr.Name {
+		case "tool-1.0/bin/tool":
+			_, err = tw.Write([]byte("tool"))
+		case "tool-1.0/share/doc/README":
+			_, err = tw.Write([]byte("readme"))
+		}
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+}
+
+func writeTestZip(t *testing.T, p string) {
+	t.Helper()
+	f, err := os.Create(p)
+	require.NoError(t, err)
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for _, e := range []struct {
+		name string
+		mode fs.FileMode
+		data string
+	}{
+		{"tool-1.0/bin/tool", 0o755, "tool"},
+		{"tool-1.0/bin/tool-alias", fs.ModeSymlink | 0o777, "tool"},
+		{"tool-1.0/bin/tool2", 0o755, "tool"},
+		{"tool-1.0/share/doc/README", 0o644, "readme"},
+	} {
+		hdr := &zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: archiveModTime}
+		hdr.SetMode(e.mode)
+		w, err := zw.CreateHeader(hdr)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(e.data))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+}
+
+func TestArchiveReader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTestTarGz(t, filepath.Join(dir, "tool.tar.gz"))
+	writeTestZip(t, filepath.Join(dir, "tool.zip"))
+
+	for _, name := range []string{"tool.tar.gz", "tool.zip"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ar, err := NewArchiveReader(filepath.Join(dir, name), 1)
+			require.NoError(t, err)
+
+			read := func(p string) string {
+				t.Helper()
+				f, err := ar.OpenPath(ctx, &spec.File{Source: p})
+				require.NoError(t, err)
+				data, err := io.ReadAll(f)
+				require.NoError(t, err)
+				return string(data)
+			}
+			require.Equal(t, "tool", read("bin/tool"))
+			require.Equal(t, "tool", read("bin/tool-alias"))
+			require.Equal(t, "tool", read("bin/tool2"))
+			require.Equal(t, "readme", read("share/doc/README"))
+
+			_, err = ar.OpenPath(ctx, &spec.File{Source: "share"})
+			require.ErrorIs(t, err, ErrIsDir)
+			_, err = ar.OpenPath(ctx, &spec.File{Source: "tool-1.0/bin/tool"})
+			require.ErrorIs(t, err, fs.ErrNotExist)
+
+			info, err := ar.Stat(ctx, &spec.File{Source: "bin/tool"})
+			require.NoError(t, err)
+			require.Equal(t, fs.FileMode(0o755), info.Mode())
+			require.True(t, archiveModTime.Equal(info.ModTime()))
+
+			files, err := ar.ListDirFiles(ctx, "bin")
+			require.NoError(t, err)
+			require.Equal(t, []*spec.File{
+				{Source: "bin/tool"},
+				{Source: "bin/tool-alias", Type: spec.FileTypeSymlink, Target: "tool"},
+				{Source: "bin/tool2"},
+			}, files)
+		})
+	}
+
+	_, err := NewArchiveReader(filepath.Join(dir, "tool.rar"), 0)
+	require.Error(t, err)
+	_, err = NewArchiveReader(filepath.Join(dir, "tool.tar.gz"), -1)
+	require.Error(t, err)
+}
@@ -8,24 +8,48 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/uservers/baggr/pkg/spec"
 )
 
-// DirWriter implements a writer that writes to a directory in the filesystem
+// DirWriter implements a writer that writes to a directory in the filesystem.
+// Copied files keep the permissions and modification time of their source.
 type DirWriter struct {
 	path string
+
+	// maxModTime clamps the modification times of the copied files
+	// when set, it is read from SOURCE_DATE_EPOCH
+	maxModTime time.Time
 }
 
 func NewDirWriter(dirPath string) *DirWriter {
 	return &DirWriter{
-		path: dirPath,
+		path:       dirPath,
+		maxModTime: sourceDateEpoch(),
+	}
+}
+
+// sourceDateEpoch returns the time set in the SOURCE_DATE_EPOCH
+// environment variable for reproducible builds
+func sourceDateEpoch() time.Time {
+	v := os.Getenv("SOURCE_DATE_EPOCH")
+	if v == "" {
+		return time.Time{}
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		logrus.Warnf("ignoring invalid SOURCE_DATE_EPOCH %q", v)
+		return time.Time{}
 	}
+	return time.Unix(secs, 0)
 }
 
 func (dw *DirWriter) Path() string {
@@ -37,40 +61,114 @@ func (dw *DirWriter) CopyPaths(ctx context.Context, r Reader, files []*spec.File
 	if dw.path == "" {
 		return fmt.Errorf("unable to copy file, no path defined")
 	}
+	hardlinks := []*spec.File{}
 	for _, specFile := range files {
+		// Ghost files are not shipped in the package
+		if specFile.Type == spec.FileTypeGhost {
+			continue
+		}
+
+		// Links are not read from the source, hard links are created
+		// once their targets have been copied
+		if specFile.Type == spec.FileTypeHardlink {
+			hardlinks = append(hardlinks, specFile)
+			continue
+		}
+		if specFile.Type == spec.FileTypeSymlink {
+			if err := dw.CreateLink(specFile); err != nil {
+				return fmt.Errorf("creating link %q: %w", specFile.Destination, err)
+			}
+			continue
+		}
+
+		// Empty directories are not read from the source
+		if specFile.IsDir() {
+			if err := dw.CreateDirectory(specFile); err != nil {
+				return fmt.Errorf("creating directory %q: %w", specFile.Destination, err)
+			}
+			continue
+		}
+
+		// Globs are copied as directories filtered by the pattern
+		if specFile.IsGlob() {
+			if err := dw.CopyDirectory(ctx, r, specFile); err != nil {
+				return fmt.Errorf("copying files matching %q: %w", specFile.Source, err)
+			}
+			continue
+		}
+
 		f, openErr := r.OpenPath(ctx, specFile)
 		var err error
 		switch {
 		case openErr != nil && errors.Is(openErr, ErrIsDir):
 			err = dw.CopyDirectory(ctx, r, specFile)
 		case openErr != nil && !errors.Is(openErr, ErrIsDir):
-			return fmt.Errorf("opening path %q: %w", specFile.Source, err)
+			return fmt.Errorf("opening path %q: %w", specFile.Source, openErr)
 		default:
 			err = dw.CopyFile(ctx, f, specFile)
+			if err == nil {
+				err = dw.copyAttributes(ctx, r, specFile)
+			}
 		}
 
 		if err != nil {
 			return fmt.Errorf("attempting to open path %q: %s", specFile.Source, err)
 		}
 	}
+
+	for _, specFile := range hardlinks {
+		if err := dw.CreateLink(specFile); err != nil {
+			return fmt.Errorf("creating link %q: %w", specFile.Destination, err)
+		}
+	}
 	return nil
 }
 
-// CopyDirectory copies a directory recursively
+// CopyDirectory copies a directory recursively. When the source is a glob,
+// it copies the files matching it under the glob base. The files excluded
+// in the spec entry or in the ignore file of the sources are skipped.
 func (dw DirWriter) CopyDirectory(ctx context.Context, r Reader, specFile *spec.File) error {
 	if dw.path == "" {
 		return fmt.Errorf("unable to copy file, no path defined")
 	}
 
-	fileList, err := r.ListDirFiles(ctx, specFile.Source)
+	base := specFile.Source
+	if specFile.IsGlob() {
+		base = specFile.GlobBase()
+	}
+	fileList, err := r.ListDirFiles(ctx, base)
+	if err != nil {
+		return fmt.Errorf("listing directory files: %w", err)
+	}
+
+	ignored, err := readIgnoreFile(ctx, r)
 	if err != nil {
-		return fmt.Errorf("listing directory files")
+		return err
 	}
+	excluded := NewExclusions(specFile.Exclude)
 
+	copied := 0
 	for _, f := range fileList {
+		rel := strings.TrimPrefix(cleanPattern(f.Source), cleanPattern(base))
+		if specFile.IsGlob() && !Match(specFile.Source, f.Source) {
+			continue
+		}
+		if cleanPattern(f.Source) == IgnoreFile || ignored.Excluded(f.Source) || excluded.Excluded(rel) {
+			logrus.Debugf("skipping excluded file %s", f.Source)
+			continue
+		}
+		copied++
+
 		// replace paths in the destination
-		if specFile.Destination != "" {
-			f.Destination = strings.ReplaceAll(f.Source, specFile.Source, specFile.Destination)
+		if specFile.Destination != "" || specFile.IsGlob() {
+			f.Destination = path.Join(specFile.DestinationPath(), rel)
+		}
+		f.Template = specFile.Template
+		if f.Type == spec.FileTypeSymlink {
+			if err := dw.CreateLink(f); err != nil {
+				return fmt.Errorf("creating link from directory: %w", err)
+			}
+			continue
 		}
 		fr, err := r.OpenPath(ctx, f)
 		if err != nil {
@@ -79,17 +177,112 @@ func (dw DirWriter) CopyDirectory(ctx context.Context, r Reader, specFile *spec.
 		if err := dw.CopyFile(ctx, fr, f); err != nil {
 			return fmt.Errorf("copying file from directory: %w", err)
 		}
+		if err := dw.copyAttributes(ctx, r, f); err != nil {
+			return fmt.Errorf("copying file attributes from directory: %w", err)
+		}
+	}
+
+	if specFile.IsGlob() && copied == 0 {
+		return fmt.Errorf("no files match %q", specFile.Source)
+	}
+
+	return nil
+}
+
+// CreateDirectory creates an empty directory in the package filesystem
+func (dw DirWriter) CreateDirectory(specFile *spec.File) error {
+	if dw.path == "" {
+		return fmt.Errorf("unable to create directory, no path defined")
+	}
+	destPath := filepath.Join(dw.path, path.Clean("/"+specFile.Destination))
+	if !strings.HasPrefix(destPath, dw.path) {
+		return fmt.Errorf("access violation")
+	}
+	if err := os.MkdirAll(destPath, os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating directory in package filesystem: %w", err)
+	}
+	return nil
+}
+
+// CreateLink creates a symbolic or hard link in the package filesystem.
+// The target of hard links is a path in the package filesystem.
+func (dw DirWriter) CreateLink(specFile *spec.File) error {
+	if dw.path == "" {
+		return fmt.Errorf("unable to create link, no path defined")
+	}
+	destPath := specFile.Destination
+	if destPath == "" {
+		destPath = specFile.Source
+	}
+	destPath = filepath.Join(dw.path, path.Clean("/"+destPath))
+	if !strings.HasPrefix(destPath, dw.path) {
+		return fmt.Errorf("access violation")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(destPath), os.FileMode(0o755)); err != nil {
+		return fmt.Errorf("creating directory in package filesystem: %w", err)
+	}
+	if err := os.Remove(destPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("replacing file in package filesystem: %w", err)
+	}
+
+	if specFile.Type == spec.FileTypeHardlink {
+		target := filepath.Join(dw.path, path.Clean("/"+specFile.Target))
+		if err := os.Link(target, destPath); err != nil {
+			return fmt.Errorf("creating hard link: %w", err)
+		}
+		return nil
 	}
+	if err := os.Symlink(specFile.Target, destPath); err != nil {
+		return fmt.Errorf("creating symbolic link: %w", err)
+	}
+	return nil
+}
 
+// copyAttributes sets the permissions and modification time of the source
+// file to its copy. The mode set in the manifest takes precedence when
+// the packages are assembled.
+func (dw DirWriter) copyAttributes(ctx context.Context, r Reader, specFile *spec.File) error {
+	info, err := r.Stat(ctx, specFile)
+	if err != nil {
+		return fmt.Errorf("reading source file info: %w", err)
+	}
+	destPath := specFile.Destination
+	if destPath == "" {
+		destPath = specFile.Source
+	}
+	destPath = filepath.Join(dw.path, path.Clean("/"+destPath))
+	if !strings.HasPrefix(destPath, dw.path) {
+		return fmt.Errorf("access violation")
+	}
+
+	mode := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	if err := os.Chmod(destPath, mode); err != nil {
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	mtime := info.ModTime()
+	if !dw.maxModTime.IsZero() && mtime.After(dw.maxModTime) {
+		mtime = dw.maxModTime
+	}
+	if err := os.Chtimes(destPath, mtime, mtime); err != nil {
+		return fmt.Errorf("setting file modification time: %w", err)
+	}
 	return nil
 }
 
 // CopyFile copies the data stream we got from the reader to a file in the
-// package filesystem
-func (dw DirWriter) CopyFile(_ context.Context, r io.Reader, specFile *spec.File) error {
+// package filesystem. Files marked as templates are rendered first.
+func (dw DirWriter) CopyFile(ctx context.Context, r io.Reader, specFile *spec.File) error {
 	if dw.path == "" {
 		return fmt.Errorf("unable to copy file, no path defined")
 	}
+	if specFile.Template {
+		rendered, err := renderTemplate(ctx, r, specFile.Source)
+		if err != nil {
+			return fmt.Errorf("rendering %s: %w", specFile.Source, err)
+		}
+		r = rendered
+	}
 	destPath := specFile.Destination
 	if destPath == "" {
 		destPath = specFile.Source
@@ -110,15 +303,20 @@ func (dw DirWriter) CopyFile(_ context.Context, r io.Reader, specFile *spec.File
 	// Create the destination file
 	destFile, err := os.Create(destPath)
 	if err != nil {
-		return fmt.Errorf("creating file in package filesystem")
+		return fmt.Errorf("creating file in package filesystem: %w", err)
 	}
 
-	// Copy the reader stream
+	// Copy the reader stream. The file is closed before returning so
+	// that the callers can set its attributes.
 	if _, err = io.Copy(destFile, r); err != nil {
+		destFile.Close()
 		return fmt.Errorf("copying data stream: %w", err)
 	}
+	if err := destFile.Close(); err != nil {
+		return fmt.Errorf("closing file in package filesystem: %w", err)
+	}
 
-	// Close the destination file
+	// Close the source stream
 	if cl, ok := r.(io.Closer); ok {
 		if err := cl.Close(); err != nil {
 			logrus.Errorf("closing copied stream failed: %v", err)
@@ -14,10 +14,12 @@ import (
 	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/liamg/memoryfs"
 	"github.com/stretchr/testify/require"
 	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/version"
 )
 
 // failReader implements an io.Reader that always fails
@@ -81,6 +83,206 @@ func TestDWCopyPaths(t *testing.T) {
 	}
 }
 
+func TestDWCopyLinks(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srcPath := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcPath, "libdir"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(srcPath, "libdir", "libtest.so.1"), []byte("ELF"), os.FileMode(0o755)))
+	require.NoError(t, os.Symlink("libtest.so.1", filepath.Join(srcPath, "libdir", "libtest.so")))
+	require.NoError(t, os.WriteFile(filepath.Join(srcPath, "test"), []byte("#!/bin/sh\n"), os.FileMode(0o755)))
+
+	dirPath := t.TempDir()
+	dw := NewDirWriter(dirPath)
+	require.NoError(t, dw.CopyPaths(ctx, NewFilesystemReader(DirFS(srcPath)), []*spec.File{
+		{Destination: "/usr/bin/test2", Type: spec.FileTypeHardlink, Target: "/usr/bin/test"},
+		{Source: "test", Destination: "/usr/bin/test"},
+		{Source: "libdir", Destination: "/usr/lib"},
+		{Destination: "/usr/bin/test-link", Type: spec.FileTypeSymlink, Target: "test"},
+	}))
+
+	target, err := os.Readlink(filepath.Join(dirPath, "usr", "lib", "libtest.so"))
+	require.NoError(t, err)
+	require.Equal(t, "libtest.so.1", target)
+
+	target, err = os.Readlink(filepath.Join(dirPath, "usr", "bin", "test-link"))
+	require.NoError(t, err)
+	require.Equal(t, "test", target)
+
+	fi1, err := os.Stat(filepath.Join(dirPath, "usr", "bin", "test"))
+	require.NoError(t, err)
+	fi2, err := os.Lstat(filepath.Join(dirPath, "usr", "bin", "test2"))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(fi1, fi2))
+}
+
+func TestDWCopyAttributes(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srcPath := t.TempDir()
+	mtime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, os.MkdirAll(filepath.Join(srcPath, "share"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(srcPath, "test.sh"), []byte("#!/bin/sh\n"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(srcPath, "share", "data"), []byte("data"), os.FileMode(0o600)))
+	require.NoError(t, os.Chmod(filepath.Join(srcPath, "test.sh"), os.FileMode(0o750)))
+	require.NoError(t, os.Chtimes(filepath.Join(srcPath, "test.sh"), mtime, mtime))
+	require.NoError(t, os.Chtimes(filepath.Join(srcPath, "share", "data"), mtime, mtime))
+
+	for _, tc := range []struct {
+		name       string
+		maxModTime time.Time
+		expected   time.Time
+	}{
+		{"preserved", time.Time{}, mtime},
+		{"clamped", mtime.Add(-time.Hour), mtime.Add(-time.Hour)},
+		{"not-clamped", mtime.Add(time.Hour), mtime},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dirPath := t.TempDir()
+			dw := NewDirWriter(dirPath)
+			dw.maxModTime = tc.maxModTime
+			require.NoError(t, dw.CopyPaths(ctx, NewFilesystemReader(DirFS(srcPath)), []*spec.File{
+				{Source: "test.sh", Destination: "/usr/bin/test"},
+				{Source: "share", Destination: "/usr/share/test"},
+			}))
+
+			for p, mode := range map[string]fs.FileMode{
+				"usr/bin/test":        0o750,
+				"usr/share/test/data": 0o600,
+			} {
+				info, err := os.Stat(filepath.Join(dirPath, p))
+				require.NoError(t, err)
+				require.Equal(t, mode, info.Mode().Perm(), p)
+				require.True(t, tc.expected.Equal(info.ModTime()), p)
+			}
+		})
+	}
+}
+
+func TestDWCopyGlob(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	srcPath := t.TempDir()
+	for _, p := range []string{
+		"bin/test", "bin/test~", "bin/sub/tool",
+		"share/es/LC_MESSAGES/test.mo", "share/es/LC_MESSAGES/test.po", "share/testdata/test.mo",
+		"docs/README.md", "docs/guide.md",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(srcPath, filepath.Dir(p)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(srcPath, p), []byte("test"), os.FileMode(0o644)))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(srcPath, IgnoreFile), []byte("# backups\n*~\ntestdata/\n"), os.FileMode(0o644)))
+	fsr := NewFilesystemReader(DirFS(srcPath))
+
+	for _, tc := range []struct {
+		name      string
+		specFiles []*spec.File
+		expected  []string
+		mustErr   bool
+	}{
+		{"glob", []*spec.File{{Source: "bin/*", Destination: "/usr/bin"}}, []string{"/usr/bin/test"}, false},
+		{"glob-no-destination", []*spec.File{{Source: "bin/*"}}, []string{"/bin/test"}, false},
+		{
+			"doublestar", []*spec.File{{Source: "share/**/*.mo", Destination: "/usr/share/locale"}},
+			[]string{"/usr/share/locale/es/LC_MESSAGES/test.mo"}, false,
+		},
+		{
+			"dir-exclude", []*spec.File{{Source: "docs", Destination: "/usr/share/doc/test", Exclude: []string{"guide.md"}}},
+			[]string{"/usr/share/doc/test/README.md"}, false,
+		},
+		{"dir-ignored", []*spec.File{{Source: "bin", Destination: "/opt/bin"}}, []string{"/opt/bin/sub/tool", "/opt/bin/test"}, false},
+		{"explicit-file", []*spec.File{{Source: "bin/test~", Destination: "/opt/test~"}}, []string{"/opt/test~"}, false},
+		{"no-matches", []*spec.File{{Source: "bin/*.sh", Destination: "/usr/bin"}}, []string{}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dirPath := t.TempDir()
+			dw := NewDirWriter(dirPath)
+			err := dw.CopyPaths(ctx, fsr, tc.specFiles)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			resFiles := []string{}
+			require.NoError(t, filepath.Walk(dirPath, func(path string, info fs.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if info.IsDir() {
+					return nil
+				}
+				resFiles = append(resFiles, strings.TrimPrefix(path, dirPath))
+				return nil
+			}))
+			slices.Sort(resFiles)
+			require.Equal(t, tc.expected, resFiles)
+		})
+	}
+}
+
+func TestDWCopyTemplate(t *testing.T) {
+	t.Parallel()
+	srcPath := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(srcPath, "conf.d"), os.FileMode(0o755)))
+	for p, data := range map[string]string{
+		"app.conf":        "name={{ .Manifest.Name }}\nversion={{ .Version.String }}-{{ .Version.Release }}\nenv={{ .Vars.env }}\n",
+		"conf.d/log.conf": "level={{ .Vars.level }}\n",
+		"missing.conf":    "{{ .Vars.missing }}",
+		"broken.conf":     "{{ .Vars.env ",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(srcPath, p), []byte(data), os.FileMode(0o640)))
+	}
+	fsr := NewFilesystemReader(DirFS(srcPath))
+	ctx := WithTemplateData(context.Background(), &TemplateData{
+		Manifest: &spec.Manifest{Component: spec.Component{Name: "app"}},
+		Version:  &version.Spec{String: "1.2.3", Release: "1"},
+		Vars:     map[string]string{"env": "prod", "level": "info"},
+	})
+
+	for _, tc := range []struct {
+		name     string
+		specFile *spec.File
+		dest     string
+		expected string
+		mustErr  bool
+	}{
+		{"file", &spec.File{Source: "app.conf", Destination: "/etc/app.conf", Template: true}, "/etc/app.conf", "name=app\nversion=1.2.3-1\nenv=prod\n", false},
+		{"not-template", &spec.File{Source: "conf.d/log.conf", Destination: "/etc/log.conf"}, "/etc/log.conf", "level={{ .Vars.level }}\n", false},
+		{"directory", &spec.File{Source: "conf.d", Destination: "/etc/app.d", Template: true}, "/etc/app.d/log.conf", "level=info\n", false},
+		{"missing-var", &spec.File{Source: "missing.conf", Destination: "/etc/missing.conf", Template: true}, "", "", true},
+		{"syntax-error", &spec.File{Source: "broken.conf", Destination: "/etc/broken.conf", Template: true}, "", "", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dirPath := t.TempDir()
+			err := NewDirWriter(dirPath).CopyPaths(ctx, fsr, []*spec.File{tc.specFile})
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			data, err := os.ReadFile(filepath.Join(dirPath, tc.dest))
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, string(data))
+
+			// Rendered files keep the mode of their source
+			info, err := os.Stat(filepath.Join(dirPath, tc.dest))
+			require.NoError(t, err)
+			require.Equal(t, fs.FileMode(0o640), info.Mode().Perm())
+		})
+	}
+
+	// Templates can't be rendered without data
+	err := NewDirWriter(t.TempDir()).CopyPaths(context.Background(), fsr, []*spec.File{{Source: "app.conf", Template: true}})
+	require.Error(t, err)
+}
+
 func TestDWCopyDirectory(t *testing.T) {
 	t.Parallel()
 	ctx := context.Background()
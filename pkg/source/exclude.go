@@ -0,0 +1,153 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// IgnoreFile is the file in the root of the sources listing the files that
+// are never copied from directories or globs
+const IgnoreFile = ".baggrignore"
+
+// Match reports whether name matches the pattern. Each element of the path
+// is matched with path.Match, except ** which matches any number of
+// directories.
+func Match(pattern, name string) bool {
+	return matchElems(strings.Split(cleanPattern(pattern), "/"), strings.Split(cleanPattern(name), "/"))
+}
+
+func matchElems(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchElems(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// cleanPattern removes the leading slash and dot of paths and patterns
+func cleanPattern(p string) string {
+	p = path.Clean("/" + p)
+	return strings.TrimPrefix(p, "/")
+}
+
+// rule is a pattern of an exclusion list
+type rule struct {
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Exclusions is a list of patterns of files not copied from the sources.
+// They use the .gitignore syntax: patterns without a slash match the names
+// at any level, a trailing slash matches only directories and a leading !
+// includes again the files excluded by a previous pattern.
+type Exclusions struct {
+	rules []rule
+}
+
+// NewExclusions returns the exclusions defined by the patterns
+func NewExclusions(patterns []string) *Exclusions {
+	e := &Exclusions{}
+	for _, p := range patterns {
+		e.Add(p)
+	}
+	return e
+}
+
+// Add appends a pattern to the exclusions, empty patterns and comments are
+// skipped
+func (e *Exclusions) Add(pattern string) {
+	p := strings.TrimSpace(pattern)
+	if p == "" || strings.HasPrefix(p, "#") {
+		return
+	}
+	r := rule{}
+	if strings.HasPrefix(p, "!") {
+		r.negate = true
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		r.dirOnly = true
+		p = strings.TrimRight(p, "/")
+	}
+	r.anchored = strings.Contains(p, "/")
+	r.pattern = cleanPattern(p)
+	e.rules = append(e.rules, r)
+}
+
+// Excluded returns true if the file at p, relative to the root of the
+// exclusions, is excluded. A file is also excluded when any of its parent
+// directories are.
+func (e *Exclusions) Excluded(p string) bool {
+	if e == nil {
+		return false
+	}
+	elems := strings.Split(cleanPattern(p), "/")
+	excluded := false
+	for _, r := range e.rules {
+		for i := range elems {
+			if r.dirOnly && i == len(elems)-1 {
+				break
+			}
+			name := elems[i]
+			if r.anchored {
+				name = strings.Join(elems[:i+1], "/")
+			}
+			if Match(r.pattern, name) {
+				excluded = !r.negate
+				break
+			}
+		}
+	}
+	return excluded
+}
+
+// readIgnoreFile reads the exclusions in the ignore file of the sources.
+// Sources without ignore file return no exclusions.
+func readIgnoreFile(ctx context.Context, r Reader) (*Exclusions, error) {
+	f, err := r.OpenPath(ctx, &spec.File{Source: IgnoreFile})
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("opening %s: %w", IgnoreFile, err)
+	}
+	if cl, ok := f.(io.Closer); ok {
+		defer cl.Close()
+	}
+
+	e := &Exclusions{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		e.Add(s.Text())
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", IgnoreFile, err)
+	}
+	return e, nil
+}
@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		pattern string
+		name    string
+		matches bool
+	}{
+		{"bin/*", "bin/test", true},
+		{"bin/*", "bin/sub/test", false},
+		{"bin/*", "/bin/test", true},
+		{"./bin/*", "bin/test", true},
+		{"share/**/*.mo", "share/es/LC_MESSAGES/test.mo", true},
+		{"share/**/*.mo", "share/test.mo", true},
+		{"share/**/*.mo", "share/es/test.po", false},
+		{"**", "a/b/c", true},
+		{"**/testdata", "pkg/x/testdata", true},
+		{"*.txt", "test.txt", true},
+		{"*.txt", "dir/test.txt", false},
+		{"[", "[", false},
+	} {
+		require.Equal(t, tc.matches, Match(tc.pattern, tc.name), "%s ~ %s", tc.pattern, tc.name)
+	}
+}
+
+func TestExclusions(t *testing.T) {
+	t.Parallel()
+	e := NewExclusions([]string{
+		"# editor backups",
+		"*~",
+		"*.orig",
+		"",
+		"testdata/",
+		"/build",
+		"docs/*.md",
+		"!docs/README.md",
+	})
+	for _, tc := range []struct {
+		path     string
+		excluded bool
+	}{
+		{"bin/test", false},
+		{"bin/test~", true},
+		{"src/main.go.orig", true},
+		{"pkg/testdata/sample.log", true},
+		{"testdata", false},
+		{"build/out", true},
+		{"src/build/out", false},
+		{"docs/guide.md", true},
+		{"docs/README.md", false},
+		{"docs/api/guide.md", false},
+	} {
+		require.Equal(t, tc.excluded, e.Excluded(tc.path), tc.path)
+	}
+
+	var none *Exclusions
+	require.False(t, none.Excluded("test"))
+}
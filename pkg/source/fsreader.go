@@ -5,10 +5,43 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
 
 	"github.com/uservers/baggr/pkg/spec"
 )
 
+// LinkFS is a filesystem that can read symbolic links
+type LinkFS interface {
+	fs.StatFS
+	ReadLink(name string) (string, error)
+}
+
+// dirFS is the filesystem of a directory tree
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+// DirFS returns a filesystem for the tree at dir. It works as os.DirFS
+// but it can also read the symbolic links in the tree.
+func DirFS(dir string) LinkFS {
+	return &dirFS{FS: os.DirFS(dir), dir: dir}
+}
+
+// Stat returns the information of a file, following links
+func (d *dirFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(d.FS, name)
+}
+
+// ReadLink returns the destination of a symbolic link
+func (d *dirFS) ReadLink(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return os.Readlink(filepath.Join(d.dir, filepath.FromSlash(name)))
+}
+
 // FilesystemReader is a source reader that takes an io.FS filesystem as the
 // source of data.
 type FilesystemReader struct {
@@ -36,6 +69,16 @@ func (fsr *FilesystemReader) ListDirFiles(_ context.Context, path string) ([]*sp
 			return nil
 		}
 
+		// Symbolic links are preserved if the filesystem can read them
+		if lfs, ok := fsr.FS.(LinkFS); ok && f.Type()&fs.ModeSymlink != 0 {
+			target, err := lfs.ReadLink(subPath)
+			if err != nil {
+				return fmt.Errorf("reading link: %w", err)
+			}
+			res = append(res, &spec.File{Source: subPath, Type: spec.FileTypeSymlink, Target: target})
+			return nil
+		}
+
 		res = append(res, &spec.File{
 			Source: subPath,
 			// Destination: "",
@@ -69,3 +112,15 @@ func (fsr *FilesystemReader) OpenPath(_ context.Context, specFile *spec.File) (i
 	}
 	return f, nil
 }
+
+// Stat returns the information of the source file of a spec entry
+func (fsr *FilesystemReader) Stat(_ context.Context, specFile *spec.File) (fs.FileInfo, error) {
+	if fsr.FS == nil {
+		return nil, fmt.Errorf("reader filesystem not set")
+	}
+	info, err := fsr.FS.Stat(specFile.Source)
+	if err != nil {
+		return nil, fmt.Errorf("reading file info: %w", err)
+	}
+	return info, nil
+}
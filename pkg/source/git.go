@@ -0,0 +1,267 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/release-utils/command"
+
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// maxLinkDepth is the number of symbolic links followed when opening a file
+const maxLinkDepth = 16
+
+// gitEntry is a file in a git tree
+type gitEntry struct {
+	mode   uint64
+	object string
+	size   int64
+}
+
+// GitReader is a source reader that reads the files from the tree of a git
+// revision instead of the working tree. Paths are relative to the reader
+// directory in the repository.
+type GitReader struct {
+	// Path is a directory in the repository
+	Path string
+
+	// Ref is the revision files are read from, such as a tag
+	Ref string
+
+	commit  string
+	modTime time.Time
+	entries map[string]gitEntry
+}
+
+// NewGitReader returns a reader of the files at ref in the repository of
+// path. The files take the time of the commit as modification time.
+func NewGitReader(dir, ref string) (*GitReader, error) {
+	gr := &GitReader{Path: dir, Ref: ref}
+	commit, err := gr.git("rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("resolving git revision %s: %w", ref, err)
+	}
+	gr.commit = strings.TrimSpace(commit)
+
+	ts, err := gr.git("show", "-s", "--format=%ct", gr.commit)
+	if err != nil {
+		return nil, fmt.Errorf("reading commit time: %w", err)
+	}
+	secs, err := strconv.ParseInt(strings.TrimSpace(ts), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parsing commit time: %w", err)
+	}
+	gr.modTime = time.Unix(secs, 0)
+
+	if err := gr.readTree(); err != nil {
+		return nil, err
+	}
+	return gr, nil
+}
+
+// readTree reads the entries of the commit tree under the reader directory
+func (gr *GitReader) readTree() error {
+	prefix, err := gr.git("rev-parse", "--show-prefix")
+	if err != nil {
+		return fmt.Errorf("reading directory in repository: %w", err)
+	}
+	output, err := gr.git("ls-tree", "-r", "-t", "-l", "-z", "--full-tree", gr.commit)
+	if err != nil {
+		return fmt.Errorf("listing git tree: %w", err)
+	}
+	gr.entries = map[string]gitEntry{}
+	for _, line := range strings.Split(output, "\x00") {
+		meta, p, ok := strings.Cut(line, "\t")
+		if !ok || !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		p = strings.TrimPrefix(p, prefix)
+		// <mode> <type> <object> <size>
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] == "commit" {
+			continue
+		}
+		mode, err := strconv.ParseUint(fields[0], 8, 32)
+		if err != nil {
+			return fmt.Errorf("parsing mode of %s: %w", p, err)
+		}
+		e := gitEntry{mode: mode, object: fields[2]}
+		if fields[1] == "blob" {
+			if e.size, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+				return fmt.Errorf("parsing size of %s: %w", p, err)
+			}
+		}
+		gr.entries[p] = e
+	}
+	return nil
+}
+
+// Commit returns the hash of the commit files are read from
+func (gr *GitReader) Commit() string {
+	return gr.commit
+}
+
+// Dirty returns true if the working tree under the reader directory has
+// changes that are not committed
+func (gr *GitReader) Dirty() (bool, error) {
+	output, err := gr.git("status", "--porcelain", "--", ".")
+	if err != nil {
+		return false, fmt.Errorf("reading git status: %w", err)
+	}
+	return strings.TrimSpace(output) != "", nil
+}
+
+// lookup returns the entry of a path, following the symbolic links
+func (gr *GitReader) lookup(p string, follow bool) (string, gitEntry, error) {
+	p = cleanPattern(p)
+	for range maxLinkDepth {
+		if p == "" {
+			return p, gitEntry{mode: 0o40000}, nil
+		}
+		e, ok := gr.entries[p]
+		if !ok {
+			return "", gitEntry{}, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+		}
+		if !follow || !e.isSymlink() {
+			return p, e, nil
+		}
+		target, err := gr.blob(e)
+		if err != nil {
+			return "", gitEntry{}, err
+		}
+		if path.IsAbs(target) {
+			return "", gitEntry{}, fmt.Errorf("link %s points outside of the source directory", p)
+		}
+		p = path.Join(path.Dir(p), target)
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return "", gitEntry{}, fmt.Errorf("link %s points outside of the source directory", p)
+		}
+		p = cleanPattern(p)
+	}
+	return "", gitEntry{}, fmt.Errorf("too many levels of links in %s", p)
+}
+
+// blob returns the contents of a file in the tree
+func (gr *GitReader) blob(e gitEntry) (string, error) {
+	output, err := command.NewWithWorkDir(gr.Path, "git", "cat-file", "blob", e.object).RunSilentSuccessOutput()
+	if err != nil {
+		return "", fmt.Errorf("reading git object %s: %w", e.object, err)
+	}
+	return output.Output(), nil
+}
+
+// OpenPath opens a file from the git tree. It returns ErrIsDir if the
+// path is a directory.
+func (gr *GitReader) OpenPath(_ context.Context, specFile *spec.File) (io.Reader, error) {
+	_, e, err := gr.lookup(specFile.Source, true)
+	if err != nil {
+		return nil, fmt.Errorf("opening path from git tree: %w", err)
+	}
+	if e.isDir() {
+		return nil, ErrIsDir
+	}
+	data, err := gr.blob(e)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader([]byte(data)), nil
+}
+
+// Stat returns the information of a file in the git tree, following links
+func (gr *GitReader) Stat(_ context.Context, specFile *spec.File) (fs.FileInfo, error) {
+	p, e, err := gr.lookup(specFile.Source, true)
+	if err != nil {
+		return nil, fmt.Errorf("reading file info from git tree: %w", err)
+	}
+	return &gitFileInfo{name: path.Base(p), entry: e, modTime: gr.modTime}, nil
+}
+
+// ListDirFiles returns the files under a directory of the git tree.
+// Symbolic links are returned as links.
+func (gr *GitReader) ListDirFiles(_ context.Context, dir string) ([]*spec.File, error) {
+	p, e, err := gr.lookup(dir, true)
+	if err != nil {
+		return nil, fmt.Errorf("listing git tree: %w", err)
+	}
+	if !e.isDir() {
+		return []*spec.File{{Source: dir}}, nil
+	}
+
+	res := []*spec.File{}
+	prefix := ""
+	if p != "" {
+		prefix = p + "/"
+	}
+	for _, name := range slices.Sorted(maps.Keys(gr.entries)) {
+		e := gr.entries[name]
+		if !strings.HasPrefix(name, prefix) || e.isDir() {
+			continue
+		}
+		source := path.Join(dir, strings.TrimPrefix(name, prefix))
+		if e.isSymlink() {
+			target, err := gr.blob(e)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, &spec.File{Source: source, Type: spec.FileTypeSymlink, Target: target})
+			continue
+		}
+		res = append(res, &spec.File{Source: source})
+	}
+	return res, nil
+}
+
+// git runs a git subcommand in the reader path and returns its output
+func (gr *GitReader) git(args ...string) (string, error) {
+	output, err := command.NewWithWorkDir(gr.Path, "git", args...).RunSilentSuccessOutput()
+	if err != nil {
+		return "", err
+	}
+	return output.OutputTrimNL(), nil
+}
+
+func (e gitEntry) isDir() bool {
+	return e.mode&0o170000 == 0o40000
+}
+
+func (e gitEntry) isSymlink() bool {
+	return e.mode&0o170000 == 0o120000
+}
+
+// gitFileInfo is the fs.FileInfo of a file in a git tree
+type gitFileInfo struct {
+	name    string
+	entry   gitEntry
+	modTime time.Time
+}
+
+func (fi *gitFileInfo) Name() string       { return fi.name }
+func (fi *gitFileInfo) Size() int64        { return fi.entry.size }
+func (fi *gitFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *gitFileInfo) IsDir() bool        { return fi.entry.isDir() }
+func (fi *gitFileInfo) Sys() any           { return nil }
+
+// Mode returns the permissions git stores: 0755 for executables and
+// directories and 0644 for the rest of the files
+func (fi *gitFileInfo) Mode() fs.FileMode {
+	switch {
+	case fi.entry.isDir():
+		return fs.ModeDir | 0o755
+	case fi.entry.mode&0o111 != 0:
+		return 0o755
+	}
+	return 0o644
+}
@@ -0,0 +1,95 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func TestGitReader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false",
+		}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	write := func(p, data string, mode os.FileMode) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(p)), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, p), []byte(data), mode))
+	}
+
+	git("init", "-q")
+	write("README", "repository", 0o644)
+	write("pkg/bin/test", "#!/bin/sh\n", 0o755)
+	write("pkg/share/data", "v1", 0o644)
+	require.NoError(t, os.Symlink("../share/data", filepath.Join(dir, "pkg", "bin", "data")))
+	git("add", "-A")
+	git("commit", "-q", "-m", "Initial commit")
+	git("tag", "v1.0.0")
+
+	write("pkg/share/data", "v2", 0o644)
+	git("commit", "-q", "-am", "Update data")
+
+	reader, err := NewGitReader(filepath.Join(dir, "pkg"), "v1.0.0")
+	require.NoError(t, err)
+
+	read := func(p string) string {
+		t.Helper()
+		f, err := reader.OpenPath(ctx, &spec.File{Source: p})
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// Files are read from the tag, relative to the reader directory
+	require.Equal(t, "v1", read("share/data"))
+	require.Equal(t, "v1", read("bin/data"))
+	require.Equal(t, "#!/bin/sh\n", read("./bin/test"))
+
+	_, err = reader.OpenPath(ctx, &spec.File{Source: "bin"})
+	require.ErrorIs(t, err, ErrIsDir)
+	_, err = reader.OpenPath(ctx, &spec.File{Source: "README"})
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	info, err := reader.Stat(ctx, &spec.File{Source: "bin/test"})
+	require.NoError(t, err)
+	require.Equal(t, fs.FileMode(0o755), info.Mode())
+	require.Equal(t, int64(10), info.Size())
+
+	files, err := reader.ListDirFiles(ctx, "bin")
+	require.NoError(t, err)
+	require.Equal(t, []*spec.File{
+		{Source: "bin/data", Type: spec.FileTypeSymlink, Target: "../share/data"},
+		{Source: "bin/test"},
+	}, files)
+
+	// Changes in the working tree make it dirty
+	dirty, err := reader.Dirty()
+	require.NoError(t, err)
+	require.False(t, dirty)
+	write("pkg/share/data", "v3", 0o644)
+	dirty, err = reader.Dirty()
+	require.NoError(t, err)
+	require.True(t, dirty)
+
+	_, err = NewGitReader(dir, "v2.0.0")
+	require.Error(t, err)
+}
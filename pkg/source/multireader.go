@@ -0,0 +1,112 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// ErrAbsolutePath is returned when reading absolute paths is not allowed
+var ErrAbsolutePath = errors.New("absolute source paths are not allowed")
+
+// Root is a named source reader used by the MultiReader
+type Root struct {
+	Name   string
+	Reader Reader
+}
+
+// MultiReader is a source reader that resolves the files from several
+// roots. Relative paths are read from the first root where they exist and
+// absolute paths from the Absolute reader, if it is set.
+type MultiReader struct {
+	Roots []Root
+
+	// Absolute reads the absolute paths, relative to its root
+	Absolute Reader
+}
+
+// NewMultiReader creates a reader that looks up the files in the roots in
+// the order they are passed
+func NewMultiReader(roots ...Root) *MultiReader {
+	return &MultiReader{
+		Roots: roots,
+	}
+}
+
+// resolve returns the reader of a path and the path in the reader
+func (mr *MultiReader) resolve(ctx context.Context, p string) (Reader, string, error) {
+	if path.IsAbs(p) {
+		if mr.Absolute == nil {
+			return nil, "", fmt.Errorf("reading %s: %w", p, ErrAbsolutePath)
+		}
+		rel := strings.TrimPrefix(path.Clean(p), "/")
+		if rel == "" {
+			rel = "."
+		}
+		return mr.Absolute, rel, nil
+	}
+
+	names := []string{}
+	for _, root := range mr.Roots {
+		_, err := root.Reader.Stat(ctx, &spec.File{Source: p})
+		if err == nil {
+			return root.Reader, p, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, "", fmt.Errorf("reading %s from %s: %w", p, root.Name, err)
+		}
+		names = append(names, root.Name)
+	}
+	return nil, "", fmt.Errorf("%s not found in %s: %w", p, strings.Join(names, ", "), fs.ErrNotExist)
+}
+
+// OpenPath opens the file from the first root where it exists
+func (mr *MultiReader) OpenPath(ctx context.Context, specFile *spec.File) (io.Reader, error) {
+	r, p, err := mr.resolve(ctx, specFile.Source)
+	if err != nil {
+		return nil, err
+	}
+	f := *specFile
+	f.Source = p
+	return r.OpenPath(ctx, &f)
+}
+
+// Stat returns the information of the file from the first root where it
+// exists
+func (mr *MultiReader) Stat(ctx context.Context, specFile *spec.File) (fs.FileInfo, error) {
+	r, p, err := mr.resolve(ctx, specFile.Source)
+	if err != nil {
+		return nil, err
+	}
+	f := *specFile
+	f.Source = p
+	return r.Stat(ctx, &f)
+}
+
+// ListDirFiles lists the files of the directory in the first root where it
+// exists. The paths of the files in absolute directories are absolute.
+func (mr *MultiReader) ListDirFiles(ctx context.Context, p string) ([]*spec.File, error) {
+	r, rp, err := mr.resolve(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	files, err := r.ListDirFiles(ctx, rp)
+	if err != nil {
+		return nil, err
+	}
+	if path.IsAbs(p) {
+		for _, f := range files {
+			f.Source = path.Join("/", f.Source)
+		}
+	}
+	return files, nil
+}
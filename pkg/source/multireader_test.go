@@ -0,0 +1,87 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/liamg/memoryfs"
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func TestMultiReader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	first := memoryfs.New()
+	require.NoError(t, first.WriteFile("test.txt", []byte("first"), os.FileMode(0o644)))
+	second := memoryfs.New()
+	require.NoError(t, second.WriteFile("test.txt", []byte("second"), os.FileMode(0o644)))
+	require.NoError(t, second.MkdirAll("docs", os.FileMode(0o755)))
+	require.NoError(t, second.WriteFile("docs/README", []byte("docs"), os.FileMode(0o644)))
+	abs := memoryfs.New()
+	require.NoError(t, abs.MkdirAll("opt/test", os.FileMode(0o755)))
+	require.NoError(t, abs.WriteFile("opt/test/data", []byte("data"), os.FileMode(0o644)))
+
+	mr := NewMultiReader(
+		Root{Name: "first", Reader: NewFilesystemReader(first)},
+		Root{Name: "second", Reader: NewFilesystemReader(second)},
+	)
+
+	read := func(p string) (string, error) {
+		f, err := mr.OpenPath(ctx, &spec.File{Source: p})
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(f)
+		return string(data), err
+	}
+
+	// Files are read from the first root where they exist
+	data, err := read("test.txt")
+	require.NoError(t, err)
+	require.Equal(t, "first", data)
+	data, err = read("docs/README")
+	require.NoError(t, err)
+	require.Equal(t, "docs", data)
+
+	_, err = read("docs")
+	require.ErrorIs(t, err, ErrIsDir)
+	_, err = read("missing.txt")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	files, err := mr.ListDirFiles(ctx, "docs")
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	require.Equal(t, "docs/README", files[0].Source)
+
+	// Absolute paths are only read when there is an absolute reader
+	_, err = read("/opt/test/data")
+	require.True(t, errors.Is(err, ErrAbsolutePath))
+
+	mr.Absolute = NewFilesystemReader(abs)
+	data, err = read("/opt/test/data")
+	require.NoError(t, err)
+	require.Equal(t, "data", data)
+
+	files, err = mr.ListDirFiles(ctx, "/opt")
+	require.NoError(t, err)
+	sources := []string{}
+	for _, f := range files {
+		sources = append(sources, f.Source)
+	}
+	slices.Sort(sources)
+	require.Equal(t, []string{"/opt/test/data"}, sources)
+
+	info, err := mr.Stat(ctx, &spec.File{Source: "/opt/test/data"})
+	require.NoError(t, err)
+	require.Equal(t, int64(4), info.Size())
+}
@@ -0,0 +1,212 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	rpmLeadSize = 96
+	arMagic     = "!<arch>\n"
+	cpioMagic   = "070701"
+	cpioTrailer = "TRAILER!!!"
+)
+
+var (
+	rpmLeadMagic   = []byte{0xed, 0xab, 0xee, 0xdb}
+	rpmHeaderMagic = []byte{0x8e, 0xad, 0xe8, 0x01}
+)
+
+// loadRPM loads the files of the cpio payload of an rpm package
+func (afs *archiveFS) loadRPM(p string, strip int) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(br, lead); err != nil {
+		return fmt.Errorf("reading rpm lead: %w", err)
+	}
+	if !bytes.HasPrefix(lead, rpmLeadMagic) {
+		return errors.New("not an rpm package")
+	}
+
+	// The signature header is padded to 8 bytes, the main header is not
+	size, err := skipRPMHeader(br)
+	if err != nil {
+		return fmt.Errorf("reading signature header: %w", err)
+	}
+	if _, err := br.Discard(int((8 - size%8) % 8)); err != nil {
+		return fmt.Errorf("reading signature header: %w", err)
+	}
+	if _, err := skipRPMHeader(br); err != nil {
+		return fmt.Errorf("reading header: %w", err)
+	}
+
+	payload, done, err := decompress(br)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return afs.loadCpio(payload, strip)
+}
+
+// skipRPMHeader reads a header structure and returns its size
+func skipRPMHeader(r *bufio.Reader) (int64, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return 0, err
+	}
+	if !bytes.HasPrefix(intro, rpmHeaderMagic) {
+		return 0, errors.New("invalid header magic")
+	}
+	nindex := int64(binary.BigEndian.Uint32(intro[8:12]))
+	hsize := int64(binary.BigEndian.Uint32(intro[12:16]))
+	size := nindex*16 + hsize
+	if _, err := io.CopyN(io.Discard, r, size); err != nil {
+		return 0, err
+	}
+	return 16 + size, nil
+}
+
+// countingReader counts the bytes read to compute the cpio padding
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// align discards the bytes up to the next multiple of 4
+func (cr *countingReader) align() error {
+	_, err := io.CopyN(io.Discard, cr, (4-cr.n%4)%4)
+	return err
+}
+
+// loadCpio loads the files of a newc cpio archive. The data of hard links
+// is stored in one of the entries sharing the inode, usually the last one.
+func (afs *archiveFS) loadCpio(r io.Reader, strip int) error {
+	cr := &countingReader{r: r}
+	links := map[uint64][]*archiveFile{}
+	hdr := make([]byte, 110)
+	for {
+		if _, err := io.ReadFull(cr, hdr); err != nil {
+			return fmt.Errorf("reading cpio header: %w", err)
+		}
+		if string(hdr[:6]) != cpioMagic {
+			return fmt.Errorf("unsupported cpio format %q", hdr[:6])
+		}
+		// ino, mode, uid, gid, nlink, mtime, filesize, devmajor, devminor,
+		// rdevmajor, rdevminor, namesize, check
+		fields := make([]uint64, 13)
+		for i := range fields {
+			v, err := strconv.ParseUint(string(hdr[6+i*8:14+i*8]), 16, 64)
+			if err != nil {
+				return fmt.Errorf("parsing cpio header: %w", err)
+			}
+			fields[i] = v
+		}
+		ino, mode, nlink, mtime, size, namesize := fields[0], fields[1], fields[4], fields[5], fields[6], fields[11]
+
+		name := make([]byte, namesize)
+		if _, err := io.ReadFull(cr, name); err != nil {
+			return fmt.Errorf("reading cpio file name: %w", err)
+		}
+		if err := cr.align(); err != nil {
+			return fmt.Errorf("reading cpio file name: %w", err)
+		}
+		fileName := strings.TrimRight(string(name), "\x00")
+		if fileName == cpioTrailer {
+			return nil
+		}
+
+		data := make([]byte, size)
+		if _, err := io.ReadFull(cr, data); err != nil {
+			return fmt.Errorf("reading %s: %w", fileName, err)
+		}
+		if err := cr.align(); err != nil {
+			return fmt.Errorf("reading %s: %w", fileName, err)
+		}
+
+		af := &archiveFile{mode: fs.FileMode(mode).Perm(), modTime: time.Unix(int64(mtime), 0)}
+		switch mode & 0o170000 {
+		case 0o040000:
+			af.mode |= fs.ModeDir
+		case 0o100000:
+			af.data = data
+			if nlink > 1 {
+				links[ino] = append(links[ino], af)
+				for _, l := range links[ino] {
+					if len(l.data) > 0 {
+						af.data = l.data
+					}
+				}
+				for _, l := range links[ino] {
+					l.data = af.data
+				}
+			}
+		case 0o120000:
+			af.mode = fs.ModeSymlink | 0o777
+			af.target = string(data)
+		default:
+			continue
+		}
+		if name := stripPath(fileName, strip); name != "" {
+			afs.add(name, af)
+		}
+	}
+}
+
+// loadDeb loads the files of the data archive of a deb package
+func (afs *archiveFS) loadDeb(p string, strip int) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != arMagic {
+		return errors.New("not a deb package")
+	}
+	hdr := make([]byte, 60)
+	for {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("data archive not found in package")
+			}
+			return fmt.Errorf("reading ar header: %w", err)
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(hdr[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return fmt.Errorf("parsing size of ar member %s: %w", name, err)
+		}
+		if strings.HasPrefix(name, "data.tar") {
+			return afs.loadTarStream(io.LimitReader(br, size), strip)
+		}
+		if _, err := br.Discard(int(size + size%2)); err != nil {
+			return fmt.Errorf("reading ar member %s: %w", name, err)
+		}
+	}
+}
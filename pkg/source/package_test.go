@@ -0,0 +1,148 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// writeTestRPM writes an rpm with an empty header and a gzip compressed
+// cpio payload
+func writeTestRPM(t *testing.T, p string) {
+	t.Helper()
+	var buf bytes.Buffer
+	lead := make([]byte, rpmLeadSize)
+	copy(lead, rpmLeadMagic)
+	buf.Write(lead)
+
+	// Signature header with one entry of 4 bytes, padded to 8 bytes
+	writeHeader := func(nindex, hsize uint32) {
+		buf.Write(rpmHeaderMagic)
+		buf.Write([]byte{0, 0, 0, 0})
+		require.NoError(t, binary.Write(&buf, binary.BigEndian, []uint32{nindex, hsize}))
+		buf.Write(make([]byte, nindex*16+hsize))
+	}
+	writeHeader(1, 4)
+	buf.Write(make([]byte, 4))
+	writeHeader(0, 0)
+
+	var cpio bytes.Buffer
+	pad := func() {
+		for cpio.Len()%4 != 0 {
+			cpio.WriteByte(0)
+		}
+	}
+	for _, e := range []struct {
+		ino, mode, nlink int
+		name, data       string
+	}{
+		{1, 0o040755, 2, "./usr/bin", ""},
+		{2, 0o100755, 2, "./usr/bin/tool", ""},
+		{2, 0o100755, 2, "./usr/bin/tool2", "tool"},
+		{3, 0o120777, 1, "./usr/bin/tool-alias", "tool"},
+		{0, 0, 1, cpioTrailer, ""},
+	} {
+		fmt.Fprintf(&cpio, "%s%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x%08x",
+			cpioMagic, e.ino, e.mode, 0, 0, e.nlink, archiveModTime.Unix(), len(e.data), 0, 0, 0, 0, len(e.name)+1, 0)
+		cpio.WriteString(e.name + "\x00")
+		pad()
+		cpio.WriteString(e.data)
+		pad()
+	}
+	gw := gzip.NewWriter(&buf)
+	_, err := gw.Write(cpio.Bytes())
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	require.NoError(t, os.WriteFile(p, buf.Bytes(), os.FileMode(0o644)))
+}
+
+// writeTestDeb writes a deb with the tar.gz of the archive tests as data
+func writeTestDeb(t *testing.T, p string) {
+	t.Helper()
+	tarPath := filepath.Join(filepath.Dir(p), "data.tar.gz")
+	writeTestTarGz(t, tarPath)
+	data, err := os.ReadFile(tarPath)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	buf.WriteString(arMagic)
+	for _, m := range []struct {
+		name string
+		data []byte
+	}{
+		{"debian-binary", []byte("2.0\n")},
+		{"control.tar.gz", []byte("odd")},
+		{"data.tar.gz", data},
+	} {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", m.name, 0, 0, 0, 0o100644, len(m.data))
+		buf.Write(m.data)
+		if len(m.data)%2 != 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	require.NoError(t, os.WriteFile(p, buf.Bytes(), os.FileMode(0o644)))
+}
+
+func TestPackageReader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTestRPM(t, filepath.Join(dir, "tool.rpm"))
+	writeTestDeb(t, filepath.Join(dir, "tool.deb"))
+
+	for _, tc := range []struct {
+		name  string
+		strip int
+	}{
+		{"tool.rpm", 0},
+		{"tool.deb", 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r, err := NewArchiveReader(filepath.Join(dir, tc.name), tc.strip)
+			require.NoError(t, err)
+
+			prefix := "usr/"
+			if tc.strip > 0 {
+				prefix = ""
+			}
+			for _, p := range []string{"bin/tool", "bin/tool2", "bin/tool-alias"} {
+				f, err := r.OpenPath(ctx, &spec.File{Source: prefix + p})
+				require.NoError(t, err, p)
+				data, err := io.ReadAll(f)
+				require.NoError(t, err)
+				require.Equal(t, "tool", string(data), p)
+			}
+
+			info, err := r.Stat(ctx, &spec.File{Source: prefix + "bin/tool"})
+			require.NoError(t, err)
+			require.Equal(t, fs.FileMode(0o755), info.Mode())
+			require.True(t, archiveModTime.Equal(info.ModTime()))
+
+			_, err = r.OpenPath(ctx, &spec.File{Source: prefix + "bin"})
+			require.ErrorIs(t, err, ErrIsDir)
+
+			files, err := r.ListDirFiles(ctx, prefix+"bin")
+			require.NoError(t, err)
+			require.Len(t, files, 3)
+			require.Equal(t, spec.FileTypeSymlink, files[1].Type)
+		})
+	}
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad.rpm"), []byte("not an rpm"), os.FileMode(0o644)))
+	_, err := NewArchiveReader(filepath.Join(dir, "bad.rpm"), 0)
+	require.Error(t, err)
+}
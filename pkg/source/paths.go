@@ -0,0 +1,66 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// PathsReader is a source reader that only reads some paths of another
+// reader, such as the outputs of the build steps. The directories leading
+// to the paths are not found in it, so that a MultiReader lists them from
+// the roots that hold the rest of their files.
+type PathsReader struct {
+	Reader Reader
+	Paths  []string
+}
+
+// NewPathsReader returns a reader of the paths in r
+func NewPathsReader(r Reader, paths ...string) *PathsReader {
+	pr := &PathsReader{Reader: r, Paths: []string{}}
+	for _, p := range paths {
+		pr.Paths = append(pr.Paths, cleanPattern(p))
+	}
+	return pr
+}
+
+// within returns true if p is one of the paths or is inside one of them
+func (pr *PathsReader) within(p string) bool {
+	p = cleanPattern(p)
+	for _, rp := range pr.Paths {
+		if p == rp || strings.HasPrefix(p, rp+"/") || rp == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenPath opens a file in the paths
+func (pr *PathsReader) OpenPath(ctx context.Context, specFile *spec.File) (io.Reader, error) {
+	if !pr.within(specFile.Source) {
+		return nil, &fs.PathError{Op: "open", Path: specFile.Source, Err: fs.ErrNotExist}
+	}
+	return pr.Reader.OpenPath(ctx, specFile)
+}
+
+// Stat returns the information of a file in the paths
+func (pr *PathsReader) Stat(ctx context.Context, specFile *spec.File) (fs.FileInfo, error) {
+	if !pr.within(specFile.Source) {
+		return nil, &fs.PathError{Op: "stat", Path: specFile.Source, Err: fs.ErrNotExist}
+	}
+	return pr.Reader.Stat(ctx, specFile)
+}
+
+// ListDirFiles lists the files of a directory in the paths
+func (pr *PathsReader) ListDirFiles(ctx context.Context, p string) ([]*spec.File, error) {
+	if !pr.within(p) {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	return pr.Reader.ListDirFiles(ctx, p)
+}
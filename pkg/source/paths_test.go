@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"testing"
+
+	"github.com/liamg/memoryfs"
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func TestPathsReader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	mfs := memoryfs.New()
+	require.NoError(t, mfs.MkdirAll("bin", os.FileMode(0o755)))
+	require.NoError(t, mfs.MkdirAll("dist/docs", os.FileMode(0o755)))
+	for _, p := range []string{"bin/server", "bin/client", "dist/docs/README", "main.go"} {
+		require.NoError(t, mfs.WriteFile(p, []byte(p), os.FileMode(0o644)))
+	}
+	pr := NewPathsReader(NewFilesystemReader(mfs), "bin/server", "./dist/")
+
+	for _, tc := range []struct {
+		path   string
+		exists bool
+	}{
+		{"bin/server", true},
+		{"dist/docs/README", true},
+		{"dist/docs", true},
+		{"bin", false},
+		{".", false},
+		{"bin/client", false},
+		{"main.go", false},
+		{"bin/server2", false},
+	} {
+		_, err := pr.Stat(ctx, &spec.File{Source: tc.path})
+		if tc.exists {
+			require.NoError(t, err, tc.path)
+		} else {
+			require.ErrorIs(t, err, fs.ErrNotExist, tc.path)
+		}
+	}
+
+	_, err := pr.OpenPath(ctx, &spec.File{Source: "bin/server"})
+	require.NoError(t, err)
+	_, err = pr.OpenPath(ctx, &spec.File{Source: "main.go"})
+	require.ErrorIs(t, err, fs.ErrNotExist)
+
+	// Directories leading to the paths are left to the other readers
+	_, err = pr.ListDirFiles(ctx, "bin")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+	files, err := pr.ListDirFiles(ctx, "dist")
+	require.NoError(t, err)
+	require.Equal(t, []*spec.File{{Source: "dist/docs/README"}}, files)
+}
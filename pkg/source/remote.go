@@ -0,0 +1,285 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+// RemoteReader is a source reader for the files downloaded from the
+// manifest sources. Files are stored in a cache addressed by their sha256
+// checksum, so they are only downloaded once and builds work offline after
+// that. The source name reads the downloaded file, and the files inside
+// archives are read as name/path.
+type RemoteReader struct {
+	// CacheDir is the directory where the files are downloaded
+	CacheDir string
+
+	// Client is the HTTP client used to download the files
+	Client *http.Client
+
+	sources map[string]*spec.RemoteSource
+	mu      sync.Mutex
+	readers map[string]Reader
+}
+
+// NewRemoteReader returns a reader for the sources that caches them in
+// cacheDir
+func NewRemoteReader(cacheDir string, sources []*spec.RemoteSource) *RemoteReader {
+	rr := &RemoteReader{
+		CacheDir: cacheDir,
+		Client:   http.DefaultClient,
+		sources:  map[string]*spec.RemoteSource{},
+		readers:  map[string]Reader{},
+	}
+	for _, rs := range sources {
+		rr.sources[rs.Name] = rs
+	}
+	return rr
+}
+
+// DefaultCacheDir returns the directory where sources are cached when no
+// other is set
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("getting user cache directory: %w", err)
+	}
+	return filepath.Join(dir, "baggr", "sources"), nil
+}
+
+// FetchAll downloads the sources missing from the cache
+func (rr *RemoteReader) FetchAll(ctx context.Context) error {
+	for _, rs := range rr.sources {
+		if _, err := rr.reader(ctx, rs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetch returns the path of the source file in the cache, downloading it
+// if it is not there or its checksum does not match
+func (rr *RemoteReader) Fetch(ctx context.Context, rs *spec.RemoteSource) (string, error) {
+	u, err := url.Parse(rs.URL)
+	if err != nil {
+		return "", fmt.Errorf("parsing URL of %s: %w", rs.Name, err)
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		name = rs.Name
+	}
+	sum := strings.ToLower(rs.SHA256)
+	dir := filepath.Join(rr.CacheDir, "sha256", sum)
+	p := filepath.Join(dir, name)
+
+	cached, err := fileSHA256(p)
+	switch {
+	case err == nil && cached == sum:
+		logrus.Debugf("using cached source %s from %s", rs.Name, p)
+		return p, nil
+	case err == nil:
+		logrus.Warnf("cached source %s does not match its checksum, downloading it again", rs.Name)
+	case !errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("checking cached source %s: %w", rs.Name, err)
+	}
+
+	if err := os.MkdirAll(dir, os.FileMode(0o755)); err != nil {
+		return "", fmt.Errorf("creating cache directory: %w", err)
+	}
+	if err := rr.download(ctx, rs, p); err != nil {
+		return "", fmt.Errorf("downloading source %s: %w", rs.Name, err)
+	}
+	return p, nil
+}
+
+// download gets the source into a temporary file and moves it to p once
+// its checksum is verified
+func (rr *RemoteReader) download(ctx context.Context, rs *spec.RemoteSource, p string) error {
+	logrus.Infof("Downloading %s", rs.URL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rs.URL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := rr.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("requesting %s: %w", rs.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("requesting %s: HTTP status %s", rs.URL, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".download-")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, h), resp.Body)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("writing download: %w", err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(rs.SHA256) {
+		return fmt.Errorf("checksum mismatch: expected sha256 %s, got %s", rs.SHA256, sum)
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return fmt.Errorf("moving download to cache: %w", err)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex encoded sha256 checksum of a file
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// reader returns the reader of a source. Archives are read with the
+// archive reader, the rest of the files from the cache directory.
+func (rr *RemoteReader) reader(ctx context.Context, rs *spec.RemoteSource) (Reader, error) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if r, ok := rr.readers[rs.Name]; ok {
+		return r, nil
+	}
+
+	p, err := rr.Fetch(ctx, rs)
+	if err != nil {
+		return nil, err
+	}
+	var r Reader
+	if archiveFormat(p) != "" {
+		if r, err = NewArchiveReader(p, rs.StripComponents); err != nil {
+			return nil, err
+		}
+	} else {
+		r = &remoteFileReader{FilesystemReader: NewFilesystemReader(DirFS(filepath.Dir(p))), name: filepath.Base(p)}
+	}
+	rr.readers[rs.Name] = r
+	return r, nil
+}
+
+// resolve returns the reader of the source of a path and the path in it
+func (rr *RemoteReader) resolve(ctx context.Context, p string) (Reader, string, error) {
+	name, rest, _ := strings.Cut(cleanPattern(p), "/")
+	rs, ok := rr.sources[name]
+	if !ok {
+		return nil, "", &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	r, err := rr.reader(ctx, rs)
+	if err != nil {
+		return nil, "", err
+	}
+	if rest == "" {
+		rest = "."
+	}
+	return r, rest, nil
+}
+
+// OpenPath opens a source file or a file in a source archive
+func (rr *RemoteReader) OpenPath(ctx context.Context, specFile *spec.File) (io.Reader, error) {
+	r, p, err := rr.resolve(ctx, specFile.Source)
+	if err != nil {
+		return nil, err
+	}
+	f := *specFile
+	f.Source = p
+	return r.OpenPath(ctx, &f)
+}
+
+// Stat returns the information of a source file or a file in a source
+// archive
+func (rr *RemoteReader) Stat(ctx context.Context, specFile *spec.File) (fs.FileInfo, error) {
+	r, p, err := rr.resolve(ctx, specFile.Source)
+	if err != nil {
+		return nil, err
+	}
+	f := *specFile
+	f.Source = p
+	return r.Stat(ctx, &f)
+}
+
+// ListDirFiles lists the files of a source. The paths returned include
+// the source name.
+func (rr *RemoteReader) ListDirFiles(ctx context.Context, p string) ([]*spec.File, error) {
+	r, rp, err := rr.resolve(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+	files, err := r.ListDirFiles(ctx, rp)
+	if err != nil {
+		return nil, err
+	}
+	name, _, _ := strings.Cut(cleanPattern(p), "/")
+	for _, f := range files {
+		f.Source = path.Join(name, f.Source)
+	}
+	return files, nil
+}
+
+// remoteFileReader reads a downloaded file that is not an archive as the
+// root of the source
+type remoteFileReader struct {
+	*FilesystemReader
+	name string
+}
+
+func (r *remoteFileReader) path(p string) (string, error) {
+	if p != "." {
+		return "", &fs.PathError{Op: "open", Path: p, Err: fs.ErrNotExist}
+	}
+	return r.name, nil
+}
+
+func (r *remoteFileReader) OpenPath(ctx context.Context, specFile *spec.File) (io.Reader, error) {
+	p, err := r.path(specFile.Source)
+	if err != nil {
+		return nil, err
+	}
+	return r.FilesystemReader.OpenPath(ctx, &spec.File{Source: p})
+}
+
+func (r *remoteFileReader) Stat(ctx context.Context, specFile *spec.File) (fs.FileInfo, error) {
+	p, err := r.path(specFile.Source)
+	if err != nil {
+		return nil, err
+	}
+	return r.FilesystemReader.Stat(ctx, &spec.File{Source: p})
+}
+
+func (r *remoteFileReader) ListDirFiles(_ context.Context, p string) ([]*spec.File, error) {
+	if _, err := r.path(p); err != nil {
+		return nil, err
+	}
+	return []*spec.File{{Source: "."}}, nil
+}
@@ -0,0 +1,89 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func TestRemoteReader(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dir := t.TempDir()
+	writeTestTarGz(t, filepath.Join(dir, "tool-1.0.tar.gz"))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "LICENSE"), []byte("MIT"), os.FileMode(0o644)))
+	checksum := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.ServeFile(w, r, filepath.Join(dir, filepath.Base(r.URL.Path)))
+	}))
+
+	sources := []*spec.RemoteSource{
+		{Name: "tool", URL: server.URL + "/tool-1.0.tar.gz", SHA256: checksum("tool-1.0.tar.gz"), StripComponents: 1},
+		{Name: "license", URL: server.URL + "/LICENSE", SHA256: checksum("LICENSE")},
+	}
+	cacheDir := t.TempDir()
+	rr := NewRemoteReader(cacheDir, sources)
+	require.NoError(t, rr.FetchAll(ctx))
+	require.Equal(t, int32(2), requests.Load())
+
+	read := func(r Reader, p string) string {
+		t.Helper()
+		f, err := r.OpenPath(ctx, &spec.File{Source: p})
+		require.NoError(t, err)
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		return string(data)
+	}
+	require.Equal(t, "tool", read(rr, "tool/bin/tool"))
+	require.Equal(t, "MIT", read(rr, "license"))
+
+	_, err := rr.OpenPath(ctx, &spec.File{Source: "tool"})
+	require.ErrorIs(t, err, ErrIsDir)
+	_, err = rr.Stat(ctx, &spec.File{Source: "other/file"})
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	files, err := rr.ListDirFiles(ctx, "tool/share")
+	require.NoError(t, err)
+	require.Equal(t, []*spec.File{{Source: "tool/share/doc/README"}}, files)
+
+	// Once cached, sources are read without the network
+	server.Close()
+	rr = NewRemoteReader(cacheDir, sources)
+	require.NoError(t, rr.FetchAll(ctx))
+	require.Equal(t, "MIT", read(rr, "license"))
+	require.Equal(t, int32(2), requests.Load())
+
+	// Downloads must match their checksum
+	server = httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+	rr = NewRemoteReader(t.TempDir(), []*spec.RemoteSource{
+		{Name: "license", URL: server.URL + "/LICENSE", SHA256: checksum("tool-1.0.tar.gz")},
+	})
+	require.Error(t, rr.FetchAll(ctx))
+
+	rr = NewRemoteReader(t.TempDir(), []*spec.RemoteSource{
+		{Name: "missing", URL: server.URL + "/missing", SHA256: checksum("LICENSE")},
+	})
+	require.Error(t, rr.FetchAll(ctx))
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"io/fs"
 
 	"github.com/uservers/baggr/pkg/spec"
 )
@@ -12,9 +13,11 @@ import (
 var ErrIsDir = errors.New("path is a directory")
 
 // Reader is an interface that defines the method to read the
-// files which will be packaged in the new package.
+// files which will be packaged in the new package. Stat returns the
+// metadata of the source file which is preserved when copying it.
 type Reader interface {
 	OpenPath(context.Context, *spec.File) (io.Reader, error)
+	Stat(context.Context, *spec.File) (fs.FileInfo, error)
 	ListDirFiles(context.Context, string) ([]*spec.File, error)
 }
 
@@ -0,0 +1,56 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"text/template"
+
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+// TemplateData is the data available to the files rendered as templates:
+// {{ .Manifest.Name }}, {{ .Version.String }} or {{ .Vars.key }}
+type TemplateData struct {
+	Manifest *spec.Manifest
+	Version  *version.Spec
+	Vars     map[string]string
+}
+
+type templateDataKey struct{}
+
+// WithTemplateData returns a context that carries the data used to render
+// the templates copied by the writers
+func WithTemplateData(ctx context.Context, data *TemplateData) context.Context {
+	return context.WithValue(ctx, templateDataKey{}, data)
+}
+
+// renderTemplate reads a file and renders it with the template data of
+// the context. Variables not defined are an error.
+func renderTemplate(ctx context.Context, r io.Reader, name string) (io.Reader, error) {
+	data, ok := ctx.Value(templateDataKey{}).(*TemplateData)
+	if !ok {
+		return nil, fmt.Errorf("no template data to render %s", name)
+	}
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading template: %w", err)
+	}
+	if cl, ok := r.(io.Closer); ok {
+		cl.Close()
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("rendering template: %w", err)
+	}
+	return &buf, nil
+}
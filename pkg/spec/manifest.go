@@ -4,15 +4,54 @@
 package spec
 
 import (
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
 	"strings"
 )
 
+// DirSource is the file source used in manifests to define an empty
+// directory owned by the package.
+const DirSource = "%DIR%"
+
 type Manifest struct {
 	Component  `yaml:",inline"`
 	URL        string
+	Maintainer string
 	Version    string
 	Release    string
 	Components []*Component
+
+	// VersionFrom points to a project file that records the version
+	VersionFrom *VersionSource `yaml:"versionFrom"`
+
+	// Sources are the files downloaded to build the packages
+	Sources []*RemoteSource
+
+	// Build are the steps run to produce the files before packaging
+	Build []*BuildStep
+
+	// Vars are the variables referenced as ${NAME} in the manifest
+	// strings. Once parsed, they hold the values resolved from the
+	// environment and the values set by the user.
+	Vars map[string]string
+}
+
+// VersionSource defines a file the package version is read from
+type VersionSource struct {
+	// File is the path to the file, relative to the manifest
+	File string
+
+	// Format is the file format: plain, json, yaml, toml or go. If empty,
+	// it is guessed from the file name.
+	Format string
+
+	// Key is the dotted path to the version in json, yaml and toml files
+	// or the name of the constant in go source files.
+	Key string
 }
 
 type Component struct {
@@ -21,12 +60,192 @@ type Component struct {
 	Summary     string
 	Description string
 	NoDeps      bool
-	Requires    []string
+	Requires    Relations
 	Files       []*File
+	Scripts     Scripts
+
+	// Provides are the virtual packages and capabilities offered by the
+	// package, in addition to its own name
+	Provides Relations
+
+	// Conflicts are packages that can't be installed at the same time
+	Conflicts Relations
+
+	// Obsoletes are packages replaced by this one, such as its old names
+	Obsoletes Relations
+
+	// Recommends, Suggests and Supplements are weak dependencies. They
+	// are skipped by the package formats that don't support them.
+	Recommends  Relations
+	Suggests    Relations
+	Supplements Relations
+
+	// Exclude are patterns of files left out of the directories and globs
+	// of all the component files
+	Exclude []string
+}
+
+// Scripts are the scriptlets that the package manager runs when the
+// component package is installed or removed. They follow the rpm semantics,
+// each worker maps them to the hooks of its package format.
+type Scripts struct {
+	PreTrans      Script `yaml:"preTrans"`
+	PreInstall    Script `yaml:"preInstall"`
+	PostInstall   Script `yaml:"postInstall"`
+	PreUninstall  Script `yaml:"preUninstall"`
+	PostUninstall Script `yaml:"postUninstall"`
+	PostTrans     Script `yaml:"postTrans"`
+}
+
+// Script is a scriptlet. In the manifest it can be written inline as a
+// string or as a mapping with a file relative to the manifest.
+type Script struct {
+	Inline string
+	File   string
+}
+
+// UnmarshalYAML reads the script from a string or a mapping
+func (s *Script) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var inline string
+	if err := unmarshal(&inline); err == nil {
+		s.Inline = inline
+		return nil
+	}
+	type plain Script
+	return unmarshal((*plain)(s))
+}
+
+// DefaultInterpreter runs the scripts that don't start with a shebang line
+const DefaultInterpreter = "/bin/sh"
+
+// Defined returns true if the script has any code
+func (s *Script) Defined() bool {
+	return strings.TrimSpace(s.Inline) != ""
+}
+
+// Interpreter returns the program in the script shebang line or the
+// default interpreter if it has none
+func (s *Script) Interpreter() string {
+	if line, _, _ := strings.Cut(s.Inline, "\n"); strings.HasPrefix(line, "#!") {
+		return strings.TrimSpace(strings.TrimPrefix(line, "#!"))
+	}
+	return DefaultInterpreter
+}
+
+// Body returns the script code without its shebang line
+func (s *Script) Body() string {
+	if strings.HasPrefix(s.Inline, "#!") {
+		_, body, _ := strings.Cut(s.Inline, "\n")
+		return body
+	}
+	return s.Inline
+}
+
+// Executable returns the script as a file that can be executed, with a
+// shebang line
+func (s *Script) Executable() string {
+	body := s.Body()
+	if !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	return "#!" + s.Interpreter() + "\n" + body
+}
+
+// Load reads the script body from its file, relative paths are resolved
+// from baseDir
+func (s *Script) Load(baseDir string) error {
+	if s.File == "" {
+		return nil
+	}
+	if s.Inline != "" {
+		return fmt.Errorf("script defines both inline code and file %s", s.File)
+	}
+	path := s.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading script: %w", err)
+	}
+	s.Inline = string(data)
+	return nil
+}
+
+// Validate checks that the shebang line of the script names a program
+func (s *Script) Validate() error {
+	if s.Defined() && strings.HasPrefix(s.Inline, "#!") && s.Interpreter() == "" {
+		return fmt.Errorf("script shebang line has no interpreter")
+	}
+	return nil
+}
+
+// Validate checks all the scripts
+func (s *Scripts) Validate() error {
+	for _, script := range []struct {
+		name   string
+		script *Script
+	}{
+		{"preTrans", &s.PreTrans}, {"preInstall", &s.PreInstall}, {"postInstall", &s.PostInstall},
+		{"preUninstall", &s.PreUninstall}, {"postUninstall", &s.PostUninstall}, {"postTrans", &s.PostTrans},
+	} {
+		if err := script.script.Validate(); err != nil {
+			return fmt.Errorf("checking %s script: %w", script.name, err)
+		}
+	}
+	return nil
+}
+
+// Load reads the bodies of the scripts defined in files
+func (s *Scripts) Load(baseDir string) error {
+	for _, script := range []*Script{
+		&s.PreTrans, &s.PreInstall, &s.PostInstall, &s.PreUninstall, &s.PostUninstall, &s.PostTrans,
+	} {
+		if err := script.Load(baseDir); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (c *Component) RequiresString() string {
-	return strings.Join(c.Requires, ", ")
+	return c.Requires.String()
+}
+
+// Validate checks the files and relationships of the component
+func (c *Component) Validate() error {
+	for _, f := range c.Files {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, p := range c.Exclude {
+		if err := validatePattern(p); err != nil {
+			return fmt.Errorf("invalid exclude pattern: %w", err)
+		}
+	}
+	return c.validateRelations()
+}
+
+// validateRelations checks the relationships of the component. Each entry
+// is validated when the manifest is parsed, but provides can only be
+// versioned with the equal operator.
+func (c *Component) validateRelations() error {
+	for _, rels := range []Relations{
+		c.Requires, c.Provides, c.Conflicts, c.Obsoletes, c.Recommends, c.Suggests, c.Supplements,
+	} {
+		for i := range rels {
+			if err := rels[i].Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	for _, p := range c.Provides {
+		if p.Operator != "" && p.Operator != OpEqual {
+			return fmt.Errorf("provides %s can only be versioned with the %s operator", p.Name, OpEqual)
+		}
+	}
+	return nil
 }
 
 type File struct {
@@ -35,6 +254,174 @@ type File struct {
 	Mode        string
 	UID         string
 	GID         string
+
+	// Type is the kind of file, empty for the regular package contents
+	Type FileType
+
+	// Target is the path the link points to in symlinks and hardlinks.
+	// Symlink targets are written as is, hardlink targets must be files
+	// in the same package.
+	Target string
+
+	// NoReplace keeps the config files edited by the admin when the
+	// package is upgraded and MissingOK allows them to be deleted
+	NoReplace bool `yaml:"noReplace"`
+	MissingOK bool `yaml:"missingOK"`
+
+	// NoVerify are the attributes not checked when verifying the package
+	// (md5, size, link, user, group, mtime, mode, rdev, caps)
+	NoVerify []string `yaml:"noVerify"`
+
+	// Exclude are patterns of files left out when the source is a
+	// directory or a glob. Patterns without a slash match the file names,
+	// the rest match the path relative to the directory or the glob base.
+	Exclude []string
+
+	// Template renders the file contents with text/template when they
+	// are copied. In directories and globs it applies to all the files.
+	Template bool
+}
+
+// FileType is the kind of a file in the package
+type FileType string
+
+const (
+	// FileTypeConfig marks configuration files, the changes made by the
+	// admin are kept on upgrades
+	FileTypeConfig FileType = "config"
+
+	// FileTypeDoc and FileTypeLicense mark documentation and license texts
+	FileTypeDoc     FileType = "doc"
+	FileTypeLicense FileType = "license"
+
+	// FileTypeGhost files are owned by the package but not shipped in it,
+	// such as logs or caches created at runtime
+	FileTypeGhost FileType = "ghost"
+
+	// FileTypeDir owns a directory but not its contents
+	FileTypeDir FileType = "dir"
+
+	// FileTypeSymlink and FileTypeHardlink create links to their target,
+	// they are not read from the source
+	FileTypeSymlink  FileType = "symlink"
+	FileTypeHardlink FileType = "hardlink"
+)
+
+// VerifyAttributes are the file attributes that can be excluded from the
+// package verification
+var VerifyAttributes = []string{"md5", "size", "link", "user", "group", "mtime", "mode", "rdev", "caps"}
+
+// IsDir returns true if the file defines a directory without reading its
+// contents from the source
+func (f *File) IsDir() bool {
+	return f.Source == DirSource || f.Type == FileTypeDir
+}
+
+// IsGlob returns true if the source is a pattern matching several files
+func (f *File) IsGlob() bool {
+	return !f.IsDir() && strings.ContainsAny(f.Source, "*?[")
+}
+
+// GlobBase returns the directory of the source glob before its first
+// pattern: "share/**/*.mo" returns "share"
+func (f *File) GlobBase() string {
+	dirs := []string{}
+	for _, d := range strings.Split(path.Dir(f.Source), "/") {
+		if strings.ContainsAny(d, "*?[") {
+			break
+		}
+		dirs = append(dirs, d)
+	}
+	if len(dirs) == 0 {
+		return "."
+	}
+	if dirs[0] == "" && len(dirs) == 1 {
+		return "/"
+	}
+	return strings.Join(dirs, "/")
+}
+
+// DestinationPath returns the path where the file is installed. Files
+// without destination are installed in their source path, or in the glob
+// base for globs.
+func (f *File) DestinationPath() string {
+	switch {
+	case f.Destination != "":
+		return f.Destination
+	case f.IsGlob():
+		return f.GlobBase()
+	}
+	return f.Source
+}
+
+// IsLink returns true if the file is a symbolic or hard link
+func (f *File) IsLink() bool {
+	return f.Type == FileTypeSymlink || f.Type == FileTypeHardlink
+}
+
+// Validate checks the file type and its options
+func (f *File) Validate() error {
+	switch f.Type {
+	case "", FileTypeConfig, FileTypeDoc, FileTypeLicense, FileTypeGhost, FileTypeDir:
+		if f.Target != "" {
+			return fmt.Errorf("file %s defines a target but it is not a link", f.Destination)
+		}
+	case FileTypeSymlink, FileTypeHardlink:
+		if f.Destination == "" || f.Target == "" {
+			return fmt.Errorf("%s %s needs a destination and a target", f.Type, f.Destination)
+		}
+		if f.Source != "" {
+			return fmt.Errorf("%s %s can't be read from a source", f.Type, f.Destination)
+		}
+	default:
+		return fmt.Errorf("invalid type %q in file %s", f.Type, f.Destination)
+	}
+	if f.Template && (f.IsLink() || f.IsDir() || f.Type == FileTypeGhost) {
+		return fmt.Errorf("file %s is rendered as a template but it has no contents", f.Destination)
+	}
+	if (f.NoReplace || f.MissingOK) && f.Type != FileTypeConfig {
+		return fmt.Errorf("file %s sets config options but it is not a config file", f.Destination)
+	}
+	for _, a := range f.NoVerify {
+		if !slices.Contains(VerifyAttributes, a) {
+			return fmt.Errorf("invalid verify attribute %q in file %s", a, f.Destination)
+		}
+	}
+	if f.IsGlob() {
+		if err := validatePattern(f.Source); err != nil {
+			return fmt.Errorf("invalid source glob in file %s: %w", f.Destination, err)
+		}
+	}
+	for _, p := range f.Exclude {
+		if err := validatePattern(p); err != nil {
+			return fmt.Errorf("invalid exclude pattern in file %s: %w", f.Destination, err)
+		}
+	}
+	return nil
+}
+
+// validatePattern checks the syntax of a glob pattern. Each element of
+// the path is a path.Match pattern or ** to match any number of
+// directories.
+func validatePattern(p string) error {
+	for _, elem := range strings.Split(p, "/") {
+		if _, err := path.Match(elem, ""); err != nil {
+			return fmt.Errorf("%q: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// SourceFiles returns copies of the component files with the component
+// exclusions added to each of them
+func (c *Component) SourceFiles() []*File {
+	res := []*File{}
+	for _, f := range c.Files {
+		f2 := f.DeepCopy()
+		f2.Exclude = append(f2.Exclude, c.Exclude...)
+		res = append(res, f2)
+	}
+	return res
 }
 
 // DeepCopy returns a pointer to a copy of the manifest
@@ -43,14 +430,30 @@ func (m *Manifest) DeepCopy() *Manifest {
 	m2 := &Manifest{
 		Component:  *c,
 		URL:        m.URL,
+		Maintainer: m.Maintainer,
 		Version:    m.Version,
 		Release:    m.Release,
 		Components: []*Component{},
+		Vars:       maps.Clone(m.Vars),
+	}
+	if m.VersionFrom != nil {
+		vf := *m.VersionFrom
+		m2.VersionFrom = &vf
 	}
 
 	for _, c := range m.Components {
 		m2.Components = append(m2.Components, c.DeepCopy())
 	}
+	for _, rs := range m.Sources {
+		rs2 := *rs
+		m2.Sources = append(m2.Sources, &rs2)
+	}
+	for _, bs := range m.Build {
+		bs2 := *bs
+		bs2.Env = maps.Clone(bs.Env)
+		bs2.Outputs = slices.Clone(bs.Outputs)
+		m2.Build = append(m2.Build, &bs2)
+	}
 
 	return m2
 }
@@ -61,8 +464,17 @@ func (c *Component) DeepCopy() *Component {
 		License:     c.License,
 		Summary:     c.Summary,
 		Description: c.Description,
-		Requires:    c.Requires,
+		NoDeps:      c.NoDeps,
+		Requires:    slices.Clone(c.Requires),
 		Files:       []*File{},
+		Scripts:     c.Scripts,
+		Provides:    slices.Clone(c.Provides),
+		Conflicts:   slices.Clone(c.Conflicts),
+		Obsoletes:   slices.Clone(c.Obsoletes),
+		Recommends:  slices.Clone(c.Recommends),
+		Suggests:    slices.Clone(c.Suggests),
+		Supplements: slices.Clone(c.Supplements),
+		Exclude:     slices.Clone(c.Exclude),
 	}
 
 	for _, f := range c.Files {
@@ -78,6 +490,13 @@ func (f *File) DeepCopy() *File {
 		Mode:        f.Mode,
 		UID:         f.UID,
 		GID:         f.GID,
+		Type:        f.Type,
+		Target:      f.Target,
+		NoReplace:   f.NoReplace,
+		MissingOK:   f.MissingOK,
+		NoVerify:    slices.Clone(f.NoVerify),
+		Exclude:     slices.Clone(f.Exclude),
+		Template:    f.Template,
 	}
 }
 
@@ -0,0 +1,239 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestScripts(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "scripts"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(dir, "scripts", "preun.sh"), []byte("#!/bin/bash\nsystemctl stop test\n"), os.FileMode(0o644),
+	))
+	manifestPath := filepath.Join(dir, "test.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte(`name: test
+scripts:
+  postInstall: |
+    systemctl daemon-reload
+  preUninstall:
+    file: scripts/preun.sh
+components:
+  - name: docs
+    scripts:
+      postTrans: mandb -q
+`), os.FileMode(0o644)))
+
+	manifest, err := NewManifestFromFile(manifestPath)
+	require.NoError(t, err)
+
+	post := manifest.Scripts.PostInstall
+	require.True(t, post.Defined())
+	require.Equal(t, DefaultInterpreter, post.Interpreter())
+	require.Equal(t, "systemctl daemon-reload\n", post.Body())
+
+	preun := manifest.Scripts.PreUninstall
+	require.Equal(t, "/bin/bash", preun.Interpreter())
+	require.Equal(t, "systemctl stop test\n", preun.Body())
+	require.Equal(t, "#!/bin/bash\nsystemctl stop test\n", preun.Executable())
+
+	require.False(t, manifest.Scripts.PreInstall.Defined())
+	require.Equal(t, "#!/bin/sh\nmandb -q\n", manifest.Components[0].Scripts.PostTrans.Executable())
+}
+
+func TestScriptLoad(t *testing.T) {
+	t.Parallel()
+	s := Script{Inline: "true", File: "script.sh"}
+	require.Error(t, s.Load(t.TempDir()))
+
+	s = Script{File: "missing.sh"}
+	require.Error(t, s.Load(t.TempDir()))
+}
+
+func TestScriptValidate(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name    string
+		inline  string
+		mustErr bool
+	}{
+		{"undefined", "", false},
+		{"no-shebang", "systemctl daemon-reload\n", false},
+		{"shebang", "#!/usr/bin/python3\nprint('hi')\n", false},
+		{"shebang-args", "#!/usr/bin/env python3\nprint('hi')\n", false},
+		{"empty-shebang", "#!\ntrue\n", true},
+		{"blank-shebang", "#!  \ntrue\n", true},
+		{"only-shebang", "#!", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			s := Script{Inline: tc.inline}
+			if tc.mustErr {
+				require.Error(t, s.Validate())
+				return
+			}
+			require.NoError(t, s.Validate())
+		})
+	}
+
+	// Scripts are checked when the manifest is parsed
+	manifestPath := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte("name: test\nscripts:\n  postInstall: |\n    #!\n    true\n"), os.FileMode(0o644)))
+	_, err := NewManifestFromFile(manifestPath)
+	require.ErrorContains(t, err, "postInstall")
+}
+
+func TestFileValidate(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		file    File
+		mustErr bool
+	}{
+		{File{Source: "test.conf", Destination: "/etc/test.conf"}, false},
+		{File{Destination: "/etc/test.conf", Type: FileTypeConfig, NoReplace: true, MissingOK: true}, false},
+		{File{Destination: "/var/log/test.log", Type: FileTypeGhost, NoVerify: []string{"user", "group"}}, false},
+		{File{Destination: "/usr/share/test", Type: FileTypeDir}, false},
+		{File{Destination: "/etc/test.conf", Type: "configuration"}, true},
+		{File{Destination: "/usr/share/doc/test", Type: FileTypeDoc, NoReplace: true}, true},
+		{File{Destination: "/etc/test.conf", Type: FileTypeConfig, NoVerify: []string{"sha256"}}, true},
+		{File{Destination: "/usr/bin/test-link", Type: FileTypeSymlink, Target: "test"}, false},
+		{File{Destination: "/usr/bin/test2", Type: FileTypeHardlink, Target: "/usr/bin/test"}, false},
+		{File{Destination: "/usr/bin/test-link", Type: FileTypeSymlink}, true},
+		{File{Source: "test", Destination: "/usr/bin/test-link", Type: FileTypeSymlink, Target: "test"}, true},
+		{File{Source: "test", Destination: "/usr/bin/test", Target: "test"}, true},
+		{File{Source: "bin/*", Destination: "/usr/bin", Exclude: []string{"*~", "testdata/"}}, false},
+		{File{Source: "bin/[", Destination: "/usr/bin"}, true},
+		{File{Source: "bin", Destination: "/usr/bin", Exclude: []string{"[a-"}}, true},
+		{File{Source: "test.conf", Destination: "/etc/test.conf", Type: FileTypeConfig, Template: true}, false},
+		{File{Destination: "/usr/bin/test-link", Type: FileTypeSymlink, Target: "test", Template: true}, true},
+		{File{Source: DirSource, Destination: "/var/lib/test", Template: true}, true},
+	} {
+		err := tc.file.Validate()
+		if tc.mustErr {
+			require.Error(t, err, tc.file.Destination)
+		} else {
+			require.NoError(t, err, tc.file.Destination)
+		}
+	}
+}
+
+func TestFileGlob(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		file        File
+		isGlob      bool
+		base        string
+		destination string
+	}{
+		{File{Source: "bin/test"}, false, "", "bin/test"},
+		{File{Source: "bin/*"}, true, "bin", "bin"},
+		{File{Source: "bin/*", Destination: "/usr/bin"}, true, "bin", "/usr/bin"},
+		{File{Source: "share/**/*.mo"}, true, "share", "share"},
+		{File{Source: "/opt/test/[ab]/*"}, true, "/opt/test", "/opt/test"},
+		{File{Source: "*.txt"}, true, ".", "."},
+		{File{Source: DirSource, Destination: "/var/lib/test"}, false, "", "/var/lib/test"},
+	} {
+		require.Equal(t, tc.isGlob, tc.file.IsGlob(), tc.file.Source)
+		if tc.isGlob {
+			require.Equal(t, tc.base, tc.file.GlobBase(), tc.file.Source)
+		}
+		require.Equal(t, tc.destination, tc.file.DestinationPath(), tc.file.Source)
+	}
+}
+
+func TestComponentSourceFiles(t *testing.T) {
+	t.Parallel()
+	c := Component{
+		Exclude: []string{"*~"},
+		Files: []*File{
+			{Source: "bin", Destination: "/usr/bin", Exclude: []string{"test"}},
+		},
+	}
+	files := c.SourceFiles()
+	require.Equal(t, []string{"test", "*~"}, files[0].Exclude)
+	require.Equal(t, []string{"test"}, c.Files[0].Exclude)
+}
+
+func TestComponentDeepCopy(t *testing.T) {
+	t.Parallel()
+	c := &Component{
+		Name:        "test",
+		License:     "MIT",
+		Summary:     "Test project",
+		Description: "Test description",
+		NoDeps:      true,
+		Requires:    Relations{{Name: "bash"}},
+		Files:       []*File{{Source: "bin/test", Destination: "/usr/bin/test", NoVerify: []string{"mtime"}}},
+		Scripts:     Scripts{PostInstall: Script{Inline: "true"}},
+		Provides:    Relations{{Name: "test-tools"}},
+		Conflicts:   Relations{{Name: "other-test"}},
+		Obsoletes:   Relations{{Name: "old-test"}},
+		Recommends:  Relations{{Name: "test-docs"}},
+		Suggests:    Relations{{Name: "test-extras"}},
+		Supplements: Relations{{Name: "test-base"}},
+		Exclude:     []string{"*~"},
+	}
+	c2 := c.DeepCopy()
+	require.Equal(t, c, c2)
+
+	c2.Requires[0].Name = "zsh"
+	c2.Files[0].NoVerify[0] = "size"
+	c2.Exclude[0] = "*.bak"
+	require.Equal(t, "bash", c.Requires[0].Name)
+	require.Equal(t, []string{"mtime"}, c.Files[0].NoVerify)
+	require.Equal(t, []string{"*~"}, c.Exclude)
+}
+
+func TestRemoteSourceValidate(t *testing.T) {
+	t.Parallel()
+	sum := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	for _, tc := range []struct {
+		source  RemoteSource
+		mustErr bool
+	}{
+		{RemoteSource{Name: "tool", URL: "https://example.com/tool.tar.gz", SHA256: sum}, false},
+		{RemoteSource{Name: "tool", URL: "http://example.com/tool", SHA256: sum, StripComponents: 1}, false},
+		{RemoteSource{URL: "https://example.com/tool.tar.gz", SHA256: sum}, true},
+		{RemoteSource{Name: "a/b", URL: "https://example.com/tool.tar.gz", SHA256: sum}, true},
+		{RemoteSource{Name: "tool", URL: "ftp://example.com/tool.tar.gz", SHA256: sum}, true},
+		{RemoteSource{Name: "tool", URL: "https://example.com/tool.tar.gz", SHA256: "abc"}, true},
+		{RemoteSource{Name: "tool", URL: "https://example.com/tool.tar.gz", SHA256: sum, StripComponents: -1}, true},
+	} {
+		err := tc.source.Validate()
+		if tc.mustErr {
+			require.Error(t, err, tc.source.Name)
+		} else {
+			require.NoError(t, err, tc.source.Name)
+		}
+	}
+}
+
+func TestBuildStepValidate(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		step    BuildStep
+		mustErr bool
+	}{
+		{BuildStep{Command: "go build -o bin/server ./cmd/server", Outputs: []string{"bin/server"}}, false},
+		{BuildStep{Command: "make", Dir: "src", Env: map[string]string{"CGO_ENABLED": "0"}}, false},
+		{BuildStep{Name: "empty", Command: " \n"}, true},
+		{BuildStep{Command: "make", Env: map[string]string{"A=B": "0"}}, true},
+		{BuildStep{Command: "make", Outputs: []string{"/usr/bin/server"}}, true},
+		{BuildStep{Command: "make", Outputs: []string{"../server"}}, true},
+		{BuildStep{Command: "make", Outputs: []string{"."}}, true},
+	} {
+		err := tc.step.Validate()
+		if tc.mustErr {
+			require.Error(t, err, tc.step.String())
+		} else {
+			require.NoError(t, err, tc.step.String())
+		}
+	}
+}
@@ -3,5 +3,13 @@ package spec
 type PackageType string
 
 const (
-	PackageTypeRPM PackageType = "rpm"
+	PackageTypeRPM        PackageType = "rpm"
+	PackageTypeDeb        PackageType = "deb"
+	PackageTypeAPK        PackageType = "apk"
+	PackageTypePacman     PackageType = "pacman"
+	PackageTypeTarGz      PackageType = "tar.gz"
+	PackageTypeTarZst     PackageType = "tar.zst"
+	PackageTypeZip        PackageType = "zip"
+	PackageTypeOCI        PackageType = "oci"
+	PackageTypeOCIArchive PackageType = "oci-archive"
 )
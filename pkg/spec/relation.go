@@ -0,0 +1,122 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Version operators supported in package relationships
+const (
+	OpLess           = "<"
+	OpLessOrEqual    = "<="
+	OpEqual          = "="
+	OpGreaterOrEqual = ">="
+	OpGreater        = ">"
+)
+
+var validOperators = map[string]bool{
+	OpLess: true, OpLessOrEqual: true, OpEqual: true, OpGreaterOrEqual: true, OpGreater: true,
+}
+
+// Relation is an entry in the relationships of a package with other
+// packages (requires, provides, conflicts...). The operator and version
+// are optional but they must be set together.
+type Relation struct {
+	Name     string
+	Operator string
+	Version  string
+}
+
+// ParseRelation parses a relation written as "name", "name >= 1.0" or
+// "name>=1.0"
+func ParseRelation(s string) (Relation, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexAny(s, "<>=")
+	if i == -1 {
+		r := Relation{Name: s}
+		return r, r.Validate()
+	}
+	rest := s[i:]
+	j := len(rest) - len(strings.TrimLeft(rest, "<>="))
+	r := Relation{
+		Name:     strings.TrimSpace(s[:i]),
+		Operator: rest[:j],
+		Version:  strings.TrimSpace(rest[j:]),
+	}
+	r.normalize()
+	return r, r.Validate()
+}
+
+// normalize accepts == as an alias of the equal operator
+func (r *Relation) normalize() {
+	if r.Operator == "==" {
+		r.Operator = OpEqual
+	}
+}
+
+// Validate checks that the relation has a name and a valid operator and
+// version
+func (r *Relation) Validate() error {
+	switch {
+	case r.Name == "":
+		return errors.New("relation has no package name")
+	case strings.ContainsAny(r.Name, " \t\n,"):
+		return fmt.Errorf("invalid package name %q", r.Name)
+	case r.Operator == "" && r.Version == "":
+		return nil
+	case r.Operator == "":
+		return fmt.Errorf("relation with %s has a version but no operator", r.Name)
+	case r.Version == "":
+		return fmt.Errorf("relation with %s has operator %s but no version", r.Name, r.Operator)
+	case strings.ContainsAny(r.Version, " \t\n,"):
+		return fmt.Errorf("invalid version %q in relation with %s", r.Version, r.Name)
+	}
+	if !validOperators[r.Operator] {
+		return fmt.Errorf("invalid operator %q in relation with %s", r.Operator, r.Name)
+	}
+	return nil
+}
+
+// UnmarshalYAML reads the relation from a string such as "bash >= 4.0"
+// or from a mapping with its name, operator and version
+func (r *Relation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		rel, err := ParseRelation(s)
+		if err != nil {
+			return err
+		}
+		*r = rel
+		return nil
+	}
+	type plain Relation
+	if err := unmarshal((*plain)(r)); err != nil {
+		return err
+	}
+	r.normalize()
+	return r.Validate()
+}
+
+// String returns the relation in the rpm spec format
+func (r Relation) String() string {
+	if r.Operator == "" {
+		return r.Name
+	}
+	return fmt.Sprintf("%s %s %s", r.Name, r.Operator, r.Version)
+}
+
+// Relations is a list of package relationships
+type Relations []Relation
+
+// String returns the relations separated by commas
+func (rs Relations) String() string {
+	strs := make([]string, 0, len(rs))
+	for _, r := range rs {
+		strs = append(strs, r.String())
+	}
+	return strings.Join(strs, ", ")
+}
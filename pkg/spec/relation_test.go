@@ -0,0 +1,78 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseRelation(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		relation string
+		expected Relation
+		mustErr  bool
+	}{
+		{"bash", Relation{Name: "bash"}, false},
+		{" perl >= 5.00502 ", Relation{Name: "perl", Operator: OpGreaterOrEqual, Version: "5.00502"}, false},
+		{"glibc<2.0", Relation{Name: "glibc", Operator: OpLess, Version: "2.0"}, false},
+		{"foo == 1:2.0-1", Relation{Name: "foo", Operator: OpEqual, Version: "1:2.0-1"}, false},
+		{"foo => 1.0", Relation{}, true},
+		{"foo >> 1.0", Relation{}, true},
+		{"foo >=", Relation{}, true},
+		{">= 1.0", Relation{}, true},
+		{"foo bar", Relation{}, true},
+		{"foo >= 1.0 2.0", Relation{}, true},
+		{"", Relation{}, true},
+	} {
+		rel, err := ParseRelation(tc.relation)
+		if tc.mustErr {
+			require.Error(t, err, tc.relation)
+			continue
+		}
+		require.NoError(t, err, tc.relation)
+		require.Equal(t, tc.expected, rel)
+	}
+}
+
+func TestRelationsYAML(t *testing.T) {
+	t.Parallel()
+	c := Component{}
+	require.NoError(t, yaml.Unmarshal([]byte(`
+requires:
+  - bash >= 4.0
+  - name: coreutils
+provides:
+  - name: test-tools
+    operator: "=="
+    version: "1.0"
+obsoletes: [old-test < 1.0]
+`), &c))
+	require.Equal(t, "bash >= 4.0, coreutils", c.RequiresString())
+	require.Equal(t, "test-tools = 1.0", c.Provides.String())
+	require.Equal(t, Relations{{Name: "old-test", Operator: OpLess, Version: "1.0"}}, c.Obsoletes)
+
+	require.Error(t, yaml.Unmarshal([]byte("conflicts: [foo ~> 1.0]"), &Component{}))
+	require.Error(t, yaml.Unmarshal([]byte("suggests: [{name: foo, version: '1.0'}]"), &Component{}))
+}
+
+func TestValidateRelations(t *testing.T) {
+	t.Parallel()
+	manifestPath := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte(`name: test
+components:
+  - name: tools
+    provides: [test-tools >= 1.0]
+`), os.FileMode(0o644)))
+	_, err := NewManifestFromFile(manifestPath)
+	require.Error(t, err)
+
+	c := Component{Requires: Relations{{Name: "foo", Operator: "~=", Version: "1"}}}
+	require.Error(t, c.Validate())
+}
@@ -0,0 +1,51 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package spec
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RemoteSource is a file downloaded to build the packages, such as a
+// release tarball. Manifest files read it with its name as source, the
+// contents of archives are read as name/path/in/archive.
+type RemoteSource struct {
+	Name string
+	URL  string
+
+	// SHA256 is the checksum the downloaded file must match
+	SHA256 string `yaml:"sha256"`
+
+	// StripComponents is the number of leading path elements removed
+	// from the files of archives
+	StripComponents int `yaml:"stripComponents"`
+}
+
+// Validate checks the name, URL and checksum of the source
+func (rs *RemoteSource) Validate() error {
+	if rs.Name == "" {
+		return errors.New("source has no name")
+	}
+	if strings.ContainsAny(rs.Name, "/\\") || rs.Name == "." || rs.Name == ".." {
+		return fmt.Errorf("invalid source name %q", rs.Name)
+	}
+	u, err := url.Parse(rs.URL)
+	if err != nil {
+		return fmt.Errorf("parsing URL of source %s: %w", rs.Name, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("source %s must be downloaded over http or https", rs.Name)
+	}
+	if b, err := hex.DecodeString(rs.SHA256); err != nil || len(b) != 32 {
+		return fmt.Errorf("source %s needs a valid sha256 checksum", rs.Name)
+	}
+	if rs.StripComponents < 0 {
+		return fmt.Errorf("invalid number of components to strip in source %s", rs.Name)
+	}
+	return nil
+}
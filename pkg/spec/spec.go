@@ -6,6 +6,7 @@ package spec
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
@@ -13,14 +14,55 @@ import (
 
 // NewManifestFromFile parses a file and returns a manifest struct
 func NewManifestFromFile(path string) (*Manifest, error) {
+	return NewManifestFromFileWithVars(path, nil)
+}
+
+// NewManifestFromFileWithVars parses a file replacing the ${NAME}
+// references in its strings with the manifest variables. The vars passed
+// override the values declared in the manifest and in the environment.
+func NewManifestFromFileWithVars(path string, vars map[string]string) (*Manifest, error) {
 	f, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading file: %w", err)
 	}
+	f, resolved, err := interpolateManifest(f, vars)
+	if err != nil {
+		return nil, fmt.Errorf("replacing manifest variables: %w", err)
+	}
 	manifest := &Manifest{}
 	if err := yaml.Unmarshal(f, manifest); err != nil {
 		return nil, err
 	}
+	manifest.Vars = resolved
+
+	// Check the components and read the scripts defined in files next
+	// to the manifest
+	for _, c := range append([]*Component{&manifest.Component}, manifest.Components...) {
+		if err := c.Validate(); err != nil {
+			return nil, fmt.Errorf("checking component %s: %w", c.Name, err)
+		}
+		if err := c.Scripts.Load(filepath.Dir(path)); err != nil {
+			return nil, fmt.Errorf("loading scripts of %s: %w", c.Name, err)
+		}
+		if err := c.Scripts.Validate(); err != nil {
+			return nil, fmt.Errorf("checking component %s: %w", c.Name, err)
+		}
+	}
+	names := map[string]struct{}{}
+	for _, rs := range manifest.Sources {
+		if err := rs.Validate(); err != nil {
+			return nil, fmt.Errorf("checking sources: %w", err)
+		}
+		if _, ok := names[rs.Name]; ok {
+			return nil, fmt.Errorf("checking sources: source %s is defined twice", rs.Name)
+		}
+		names[rs.Name] = struct{}{}
+	}
+	for i, bs := range manifest.Build {
+		if err := bs.Validate(); err != nil {
+			return nil, fmt.Errorf("checking build step %d: %w", i+1, err)
+		}
+	}
 	logrus.Infof("parsed manifest from %s", path)
 	return manifest, nil
 }
@@ -0,0 +1,61 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// BuildStep is a command run before the packages are built to produce
+// files for them, such as compiling a binary. Steps run in order with the
+// shell and the files they declare as outputs can be used as file sources.
+type BuildStep struct {
+	Name string
+
+	// Command is the shell script run by the step
+	Command string
+
+	// Dir is the working directory of the command, relative to the
+	// manifest. It defaults to the manifest directory.
+	Dir string
+
+	// Env are variables added to the environment of the command
+	Env map[string]string
+
+	// Outputs are the files and directories produced by the step,
+	// relative to the manifest. They must exist when the step finishes.
+	Outputs []string
+}
+
+// Validate checks the command and outputs of the step
+func (bs *BuildStep) Validate() error {
+	if strings.TrimSpace(bs.Command) == "" {
+		return errors.New("build step has no command")
+	}
+	for k := range bs.Env {
+		if k == "" || strings.ContainsAny(k, "= ") {
+			return fmt.Errorf("invalid environment variable name %q", k)
+		}
+	}
+	for _, o := range bs.Outputs {
+		if path.IsAbs(o) || !fs.ValidPath(path.Clean(o)) || path.Clean(o) == "." {
+			return fmt.Errorf("output %q must be a path inside the manifest directory", o)
+		}
+	}
+	return nil
+}
+
+// String returns the name of the step or, if it has none, the first line
+// of its command
+func (bs *BuildStep) String() string {
+	if bs.Name != "" {
+		return bs.Name
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(bs.Command), "\n")
+	return line
+}
@@ -0,0 +1,144 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package spec
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var (
+	// varReference matches ${NAME} and the $${ escape of a literal ${
+	varReference = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+	varName      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// ResolveVars returns the values of the manifest variables. The values in
+// the vars block are overridden by the environment variables with the same
+// name and then by the values set by the user, which don't need to be
+// declared.
+func ResolveVars(declared, set map[string]string) (map[string]string, error) {
+	vars := map[string]string{}
+	for k, v := range declared {
+		if !varName.MatchString(k) {
+			return nil, fmt.Errorf("invalid variable name %q", k)
+		}
+		vars[k] = v
+		if ev, ok := os.LookupEnv(k); ok {
+			vars[k] = ev
+		}
+	}
+	for k, v := range set {
+		vars[k] = v
+	}
+	return vars, nil
+}
+
+// Interpolate replaces the ${NAME} references in s with the values of the
+// variables. $${ is written as a literal ${, such as in shell scripts.
+func Interpolate(s string, vars map[string]string) (string, error) {
+	var err error
+	res := varReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$${" {
+			return "${"
+		}
+		name := ref[2 : len(ref)-1]
+		if !varName.MatchString(name) {
+			if err == nil {
+				err = fmt.Errorf("invalid variable reference %s", ref)
+			}
+			return ref
+		}
+		v, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("variable %s is not defined, declare it in vars or write $${ for a literal ${", name)
+		}
+		return v
+	})
+	if err != nil {
+		return "", err
+	}
+	return res, nil
+}
+
+// interpolateManifest replaces the variables in the string values of a
+// manifest document. The values of the vars block are not interpolated and
+// the scalars without variables keep their original text, so unquoted
+// values such as file modes are read as they were written.
+// It returns the document and the resolved variables.
+func interpolateManifest(data []byte, set map[string]string) ([]byte, map[string]string, error) {
+	declared := struct {
+		Vars map[string]string
+	}{}
+	if err := yaml.Unmarshal(data, &declared); err != nil {
+		return nil, nil, err
+	}
+	vars, err := ResolveVars(declared.Vars, set)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc := yamlv3.Node{}
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return data, vars, nil
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key := root.Content[i].Value
+		if key == "vars" {
+			continue
+		}
+		if err := interpolateNode(root.Content[i+1], key, vars); err != nil {
+			return nil, nil, err
+		}
+	}
+	data, err = yamlv3.Marshal(&doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, vars, nil
+}
+
+// interpolateNode replaces the variables in the scalars of a yaml node.
+// The path of the node is used in the errors.
+func interpolateNode(n *yamlv3.Node, p string, vars map[string]string) error {
+	switch n.Kind {
+	case yamlv3.ScalarNode:
+		if !strings.Contains(n.Value, "${") {
+			return nil
+		}
+		res, err := Interpolate(n.Value, vars)
+		if err != nil {
+			return fmt.Errorf("interpolating %s: %w", p, err)
+		}
+		n.Value = res
+		// Plain values are resolved as if the result had been written
+		// in the manifest, eg a variable set to true in a boolean field
+		if n.Style == 0 {
+			n.Tag = ""
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := fmt.Sprintf("%s.%s", p, n.Content[i].Value)
+			if err := interpolateNode(n.Content[i+1], key, vars); err != nil {
+				return err
+			}
+		}
+	case yamlv3.SequenceNode:
+		for i, c := range n.Content {
+			if err := interpolateNode(c, fmt.Sprintf("%s[%d]", p, i), vars); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
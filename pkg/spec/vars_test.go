@@ -0,0 +1,116 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package spec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Parallel()
+	vars := map[string]string{"ENV": "prod", "PORT": "8080", "EMPTY": ""}
+	for _, tc := range []struct {
+		input    string
+		expected string
+		mustErr  bool
+	}{
+		{"no variables", "no variables", false},
+		{"app-${ENV}", "app-prod", false},
+		{"${ENV}:${PORT}${EMPTY}", "prod:8080", false},
+		{"echo $${HOME} $HOME $$", "echo ${HOME} $HOME $$", false},
+		{"$${ENV} ${ENV}", "${ENV} prod", false},
+		{"${MISSING}", "", true},
+		{"${}", "", true},
+		{"${1ENV}", "", true},
+	} {
+		res, err := Interpolate(tc.input, vars)
+		if tc.mustErr {
+			require.Error(t, err, tc.input)
+			continue
+		}
+		require.NoError(t, err, tc.input)
+		require.Equal(t, tc.expected, res)
+	}
+}
+
+func TestManifestVars(t *testing.T) {
+	t.Setenv("BAGGR_TEST_REGION", "eu")
+	dir := t.TempDir()
+	manifestPath := filepath.Join(dir, "test.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte(`name: app-${ENV}
+summary: App for ${ENV} in ${BAGGR_TEST_REGION}
+vars:
+  ENV: dev
+  PORT: "8080"
+  BAGGR_TEST_REGION: us
+requires:
+  - app-common >= ${PORT}
+files:
+  - source: conf/${ENV}.conf
+    destination: /etc/app/app.conf
+    mode: "0640"
+scripts:
+  postInstall: echo $${HOME} listening on ${PORT}
+`), os.FileMode(0o644)))
+
+	// Declared values are overridden by the environment
+	manifest, err := NewManifestFromFile(manifestPath)
+	require.NoError(t, err)
+	require.Equal(t, "app-dev", manifest.Name)
+	require.Equal(t, "App for dev in eu", manifest.Summary)
+	require.Equal(t, "8080", manifest.Requires[0].Version)
+	require.Equal(t, "conf/dev.conf", manifest.Files[0].Source)
+	require.Equal(t, "0640", manifest.Files[0].Mode)
+	require.Equal(t, "echo ${HOME} listening on 8080", manifest.Scripts.PostInstall.Body())
+	require.Equal(t, map[string]string{"ENV": "dev", "PORT": "8080", "BAGGR_TEST_REGION": "eu"}, manifest.Vars)
+
+	// And the environment by the values set by the user
+	manifest, err = NewManifestFromFileWithVars(manifestPath, map[string]string{"ENV": "prod", "BAGGR_TEST_REGION": "ap", "EXTRA": "x"})
+	require.NoError(t, err)
+	require.Equal(t, "app-prod", manifest.Name)
+	require.Equal(t, "App for prod in ap", manifest.Summary)
+	require.Equal(t, "x", manifest.Vars["EXTRA"])
+
+	// Variables must be defined
+	require.NoError(t, os.WriteFile(manifestPath, []byte("name: app\nfiles:\n  - source: ${BIN}\n"), os.FileMode(0o644)))
+	_, err = NewManifestFromFile(manifestPath)
+	require.ErrorContains(t, err, "files[0].source")
+	_, err = NewManifestFromFileWithVars(manifestPath, map[string]string{"BIN": "bin/app"})
+	require.NoError(t, err)
+}
+
+func TestManifestVarsKeepValues(t *testing.T) {
+	t.Parallel()
+	manifestPath := filepath.Join(t.TempDir(), "test.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte(`name: app
+version: 1.10
+nodeps: ${NODEPS}
+vars:
+  NODEPS: "true"
+  SUFFIX: "1.20"
+requires:
+  - app-common >= 1.10
+files:
+  - source: bin/app
+    destination: /usr/bin/app
+    mode: 0755
+  - source: bin/app-${SUFFIX}
+    destination: /usr/bin/app-${SUFFIX} # comment
+    mode: 0644
+`), os.FileMode(0o644)))
+
+	// Unquoted values without variables are read as they were written
+	manifest, err := NewManifestFromFile(manifestPath)
+	require.NoError(t, err)
+	require.Equal(t, "1.10", manifest.Version)
+	require.Equal(t, "1.10", manifest.Requires[0].Version)
+	require.Equal(t, "0755", manifest.Files[0].Mode)
+	require.Equal(t, "0644", manifest.Files[1].Mode)
+	require.Equal(t, "/usr/bin/app-1.20", manifest.Files[1].Destination)
+	require.True(t, manifest.NoDeps)
+}
@@ -0,0 +1,357 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package staging reads back the files that a source.Writer copied to its
+// staging directory so that native package writers can build their payloads.
+package staging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/source"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+// DefaultOwner is the user and group name assigned to files that don't
+// define one in the manifest.
+const DefaultOwner = "root"
+
+// Entry is a filesystem object that will be written to a package payload
+type Entry struct {
+	// Path is the absolute path of the entry in the installed system
+	Path string
+
+	// Source is the path of the staged file, empty for directories that
+	// don't exist in the staging directory (%DIR%).
+	Source string
+
+	Mode    fs.FileMode
+	Owner   string
+	Group   string
+	UID     int
+	GID     int
+	Size    int64
+	ModTime time.Time
+
+	// Linkname is the target of symbolic links or, in hard links, the
+	// path of the first entry that shares the file data
+	Linkname string
+
+	// File is the manifest file the entry was collected from, nil for
+	// the parent directories added to the payload
+	File *spec.File
+}
+
+// Is returns true if the entry was collected from a file of type t
+func (e *Entry) Is(t spec.FileType) bool {
+	return e.File != nil && e.File.Type == t
+}
+
+// IsDir returns true if the entry is a directory
+func (e *Entry) IsDir() bool {
+	return e.Mode.IsDir()
+}
+
+// IsSymlink returns true if the entry is a symbolic link
+func (e *Entry) IsSymlink() bool {
+	return e.Mode&fs.ModeSymlink != 0
+}
+
+// IsHardlink returns true if the entry is a hard link to another entry
+func (e *Entry) IsHardlink() bool {
+	return e.Linkname != "" && e.Mode.IsRegular()
+}
+
+// Open opens the staged file for reading
+func (e *Entry) Open() (*os.File, error) {
+	if e.Source == "" || !e.Mode.IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", e.Path)
+	}
+	return os.Open(e.Source)
+}
+
+// Collect returns the entries that the component owns from the staging
+// directory at root. Files defined in the manifest as directories are
+// walked recursively. The list is sorted by path, so parent directories
+// are always listed before their contents.
+func Collect(root string, c *spec.Component) ([]*Entry, error) {
+	seen := map[string]int{}
+	res := []*Entry{}
+	for _, f := range c.Files {
+		entries, err := collectFile(root, f)
+		if err != nil {
+			return nil, fmt.Errorf("collecting %q: %w", f.Destination, err)
+		}
+		for _, e := range entries {
+			// Files declared in the manifest take precedence over the
+			// contents of a directory that includes them
+			if i, ok := seen[e.Path]; ok {
+				if e.declared() && !res[i].declared() {
+					res[i] = e
+				}
+				continue
+			}
+			seen[e.Path] = len(res)
+			res = append(res, e)
+		}
+	}
+
+	slices.SortFunc(res, func(a, b *Entry) int {
+		switch {
+		case a.Path < b.Path:
+			return -1
+		case a.Path > b.Path:
+			return 1
+		}
+		return 0
+	})
+	if err := resolveHardlinks(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// resolveHardlinks links the hard links in the manifest to the first entry
+// of their set so that it is written before the links in the payloads.
+// The links take the attributes of their target.
+func resolveHardlinks(entries []*Entry) error {
+	byPath := map[string]*Entry{}
+	sets := map[string][]*Entry{}
+	for _, e := range entries {
+		byPath[e.Path] = e
+	}
+	for _, e := range entries {
+		if !e.Is(spec.FileTypeHardlink) {
+			continue
+		}
+		target, ok := byPath[e.Linkname]
+		if !ok || !target.Mode.IsRegular() || target.IsHardlink() {
+			return fmt.Errorf("hard link %s must point to a regular file in the package", e.Path)
+		}
+		if _, ok := sets[target.Path]; !ok {
+			sets[target.Path] = []*Entry{target}
+		}
+		sets[target.Path] = append(sets[target.Path], e)
+	}
+
+	for _, set := range sets {
+		target := set[0]
+		slices.SortFunc(set, func(a, b *Entry) int { return strings.Compare(a.Path, b.Path) })
+		for i, e := range set {
+			e.Mode, e.Size = target.Mode, target.Size
+			e.Owner, e.Group, e.UID, e.GID = target.Owner, target.Group, target.UID, target.GID
+			e.Linkname = ""
+			if i > 0 {
+				e.Linkname = set[0].Path
+			}
+		}
+	}
+	return nil
+}
+
+// declared returns true if the entry path is the one of its manifest file
+func (e *Entry) declared() bool {
+	if e.File == nil {
+		return false
+	}
+	return path.Join("/", e.File.DestinationPath()) == e.Path
+}
+
+// WithoutGhosts returns the entries that are shipped in the package
+// payload, dropping the ghost files
+func WithoutGhosts(entries []*Entry) []*Entry {
+	res := []*Entry{}
+	for _, e := range entries {
+		if !e.Is(spec.FileTypeGhost) {
+			res = append(res, e)
+		}
+	}
+	return res
+}
+
+// collectFile builds the entries for a single manifest file
+func collectFile(root string, f *spec.File) ([]*Entry, error) {
+	destPath := path.Join("/", f.DestinationPath())
+
+	owner, uid := parseOwner(f.UID)
+	group, gid := parseOwner(f.GID)
+	mode, err := parseMode(f.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	// Empty directories and ghost files don't exist in the staging
+	// directory, directory types own only the directory itself
+	if f.IsDir() || f.Type == spec.FileTypeGhost {
+		e := &Entry{
+			Path:    destPath,
+			Owner:   owner,
+			Group:   group,
+			UID:     uid,
+			GID:     gid,
+			ModTime: time.Now(),
+			File:    f,
+		}
+		if f.IsDir() {
+			if mode == 0 {
+				mode = 0o755
+			}
+			e.Mode = fs.ModeDir | mode
+		} else {
+			if mode == 0 {
+				mode = 0o644
+			}
+			e.Mode = mode
+		}
+		return []*Entry{e}, nil
+	}
+
+	stagedRoot := filepath.Join(root, filepath.FromSlash(destPath))
+	res := []*Entry{}
+	if err := filepath.WalkDir(stagedRoot, func(p string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(stagedRoot, p)
+		if err != nil {
+			return err
+		}
+
+		e := &Entry{
+			Path:    path.Join(destPath, filepath.ToSlash(rel)),
+			Source:  p,
+			Mode:    info.Mode(),
+			Owner:   owner,
+			Group:   group,
+			UID:     uid,
+			GID:     gid,
+			ModTime: info.ModTime(),
+			File:    f,
+		}
+
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			if e.Linkname, err = os.Readlink(p); err != nil {
+				return fmt.Errorf("reading link: %w", err)
+			}
+			e.Size = int64(len(e.Linkname))
+		case info.Mode().IsRegular():
+			e.Size = info.Size()
+			if f.Type == spec.FileTypeHardlink {
+				e.Linkname = path.Join("/", f.Target)
+			}
+			// The manifest mode only applies to files, directories
+			// keep the mode they were staged with.
+			if mode != 0 {
+				e.Mode = mode
+			}
+		case info.IsDir():
+		default:
+			return fmt.Errorf("unsupported file type in %s", p)
+		}
+		res = append(res, e)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("walking staged files: %w", err)
+	}
+	return res, nil
+}
+
+// parseMode reads an octal mode string from the manifest. Empty modes or
+// the rpm-style "-" return zero.
+func parseMode(s string) (fs.FileMode, error) {
+	if s == "" || s == "-" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid file mode %q: %w", s, err)
+	}
+	return fs.FileMode(m) & fs.ModePerm, nil
+}
+
+// parseOwner returns the name and numeric ID of a user or group defined in
+// the manifest. Numeric IDs have no name and names are assumed to be
+// resolved by the package manager at install time.
+func parseOwner(s string) (name string, id int) {
+	if s == "" || s == "-" {
+		return DefaultOwner, 0
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n == 0 {
+			return DefaultOwner, 0
+		}
+		return s, n
+	}
+	return s, 0
+}
+
+// CopyFiles copies the files of all the manifest components from the
+// source reader using the source writer
+func CopyFiles(ctx context.Context, opts *build.Options, sourceWriter source.Writer, manifest *spec.Manifest) error {
+	if opts.SourceReader == nil {
+		return fmt.Errorf("unable to copy files, no source reader defined")
+	}
+
+	if err := sourceWriter.CopyPaths(ctx, opts.SourceReader, manifest.Component.SourceFiles()); err != nil {
+		return fmt.Errorf("copying main component files: %w", err)
+	}
+
+	for _, c := range manifest.Components {
+		if err := sourceWriter.CopyPaths(ctx, opts.SourceReader, c.SourceFiles()); err != nil {
+			return fmt.Errorf("copying files from %q: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// ResolveVersion returns the version to use in packages. When no version is
+// set in the options, the version computed in the build context is used.
+func ResolveVersion(ctx context.Context, opts *build.Options) (*version.Spec, error) {
+	if opts.Version != nil && opts.Version.String != "" {
+		return opts.Version, nil
+	}
+
+	var ver *version.Spec
+	switch bc := ctx.Value(build.ContextKey{}).(type) {
+	case *build.Context:
+		ver = bc.Version
+	case build.Context:
+		ver = bc.Version
+	default:
+		return nil, errors.New("unable to read build context")
+	}
+
+	if ver == nil {
+		return nil, errors.New("no version set in options or found in build context")
+	}
+	return ver, nil
+}
+
+// ManifestDir returns the directory of the manifest stored in the build
+// context. Relative paths in the manifest are read from it.
+func ManifestDir(ctx context.Context) string {
+	switch bc := ctx.Value(build.ContextKey{}).(type) {
+	case *build.Context:
+		return bc.ManifestDir
+	case build.Context:
+		return bc.ManifestDir
+	}
+	return ""
+}
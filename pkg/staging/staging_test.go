@@ -0,0 +1,281 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package staging
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/spec"
+)
+
+func TestParseMode(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		mode     string
+		expected fs.FileMode
+		mustErr  bool
+	}{
+		{"empty", "", 0, false},
+		{"dash", "-", 0, false},
+		{"leading-zero", "0755", 0o755, false},
+		{"no-leading-zero", "644", 0o644, false},
+		{"special-bits", "4755", 0o755, false},
+		{"not-octal", "0789", 0, true},
+		{"text", "rwx", 0, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			res, err := parseMode(tc.mode)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, res)
+		})
+	}
+}
+
+func TestParseOwner(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name   string
+		owner  string
+		expect string
+		id     int
+	}{
+		{"empty", "", DefaultOwner, 0},
+		{"dash", "-", DefaultOwner, 0},
+		{"zero", "0", DefaultOwner, 0},
+		{"numeric", "1000", "1000", 1000},
+		{"name", "nginx", "nginx", 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			name, id := parseOwner(tc.owner)
+			require.Equal(t, tc.expect, name)
+			require.Equal(t, tc.id, id)
+		})
+	}
+}
+
+func TestWithoutGhosts(t *testing.T) {
+	t.Parallel()
+	ghost := &Entry{Path: "/var/log/test.log", File: &spec.File{Type: spec.FileTypeGhost}}
+	conf := &Entry{Path: "/etc/test.conf", File: &spec.File{Type: spec.FileTypeConfig}}
+	parent := &Entry{Path: "/etc", Mode: fs.ModeDir | 0o755}
+
+	for _, tc := range []struct {
+		name     string
+		entries  []*Entry
+		expected []*Entry
+	}{
+		{"empty", []*Entry{}, []*Entry{}},
+		{"no-ghosts", []*Entry{parent, conf}, []*Entry{parent, conf}},
+		{"ghosts", []*Entry{parent, conf, ghost}, []*Entry{parent, conf}},
+		{"only-ghosts", []*Entry{ghost}, []*Entry{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tc.expected, WithoutGhosts(tc.entries))
+		})
+	}
+}
+
+func TestResolveHardlinks(t *testing.T) {
+	t.Parallel()
+	hardlink := &spec.File{Type: spec.FileTypeHardlink}
+	file := func(p string) *Entry {
+		return &Entry{Path: p, Mode: 0o755, Size: 10, Owner: "daemon", UID: 2}
+	}
+	link := func(p, target string) *Entry {
+		return &Entry{Path: p, Mode: 0o644, Size: 10, Owner: DefaultOwner, Linkname: target, File: hardlink}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		entries   []*Entry
+		linknames map[string]string
+		mustErr   bool
+	}{
+		{
+			"no-links",
+			[]*Entry{file("/usr/bin/test")},
+			map[string]string{"/usr/bin/test": ""},
+			false,
+		},
+		{
+			"link-after-target",
+			[]*Entry{file("/usr/bin/test"), link("/usr/bin/test2", "/usr/bin/test")},
+			map[string]string{"/usr/bin/test": "", "/usr/bin/test2": "/usr/bin/test"},
+			false,
+		},
+		{
+			// The first path of the set holds the data, the target
+			// becomes a link to it
+			"link-before-target",
+			[]*Entry{link("/usr/bin/a-test", "/usr/bin/test"), file("/usr/bin/test")},
+			map[string]string{"/usr/bin/a-test": "", "/usr/bin/test": "/usr/bin/a-test"},
+			false,
+		},
+		{
+			"several-links",
+			[]*Entry{
+				link("/usr/bin/a-test", "/usr/bin/test"), file("/usr/bin/test"),
+				link("/usr/bin/z-test", "/usr/bin/test"),
+			},
+			map[string]string{"/usr/bin/a-test": "", "/usr/bin/test": "/usr/bin/a-test", "/usr/bin/z-test": "/usr/bin/a-test"},
+			false,
+		},
+		{
+			"missing-target",
+			[]*Entry{link("/usr/bin/test2", "/usr/bin/test")},
+			nil,
+			true,
+		},
+		{
+			"directory-target",
+			[]*Entry{{Path: "/usr/bin", Mode: fs.ModeDir | 0o755}, link("/usr/bin/test2", "/usr/bin")},
+			nil,
+			true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := resolveHardlinks(tc.entries)
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			for _, e := range tc.entries {
+				require.Equal(t, tc.linknames[e.Path], e.Linkname, e.Path)
+				// Links take the attributes of their target
+				require.Equal(t, fs.FileMode(0o755), e.Mode, e.Path)
+				require.Equal(t, "daemon", e.Owner, e.Path)
+				require.Equal(t, 2, e.UID, e.Path)
+			}
+		})
+	}
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "usr", "bin"), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr", "bin", "test"), []byte("#!/bin/sh\n"), os.FileMode(0o644)))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "usr", "bin", "helper"), []byte("#!/bin/sh\n"), os.FileMode(0o644)))
+	require.NoError(t, os.Link(filepath.Join(root, "usr", "bin", "test"), filepath.Join(root, "usr", "bin", "a-test")))
+	require.NoError(t, os.Symlink("test", filepath.Join(root, "usr", "bin", "test-link")))
+
+	for _, tc := range []struct {
+		name     string
+		files    []*spec.File
+		expected map[string]fs.FileMode
+		links    map[string]string
+		mustErr  bool
+	}{
+		{
+			name:     "file",
+			files:    []*spec.File{{Source: "bin/test", Destination: "/usr/bin/test", Mode: "0755"}},
+			expected: map[string]fs.FileMode{"/usr/bin/test": 0o755},
+		},
+		{
+			name:  "directory",
+			files: []*spec.File{{Source: "bin", Destination: "/usr/bin", Mode: "0700"}},
+			expected: map[string]fs.FileMode{
+				"/usr/bin":           fs.ModeDir | 0o755,
+				"/usr/bin/a-test":    0o700,
+				"/usr/bin/helper":    0o700,
+				"/usr/bin/test":      0o700,
+				"/usr/bin/test-link": fs.ModeSymlink | 0o777,
+			},
+			links: map[string]string{"/usr/bin/test-link": "test"},
+		},
+		{
+			// Files declared in the manifest take precedence over the
+			// directory that contains them, in any order
+			name: "declared-file-precedence",
+			files: []*spec.File{
+				{Source: "bin/test", Destination: "/usr/bin/test", Mode: "0750"},
+				{Source: "bin", Destination: "/usr/bin", Mode: "0700"},
+				{Source: "bin/helper", Destination: "/usr/bin/helper", Mode: "0755"},
+			},
+			expected: map[string]fs.FileMode{
+				"/usr/bin":           fs.ModeDir | 0o755,
+				"/usr/bin/a-test":    0o700,
+				"/usr/bin/helper":    0o755,
+				"/usr/bin/test":      0o750,
+				"/usr/bin/test-link": fs.ModeSymlink | 0o777,
+			},
+			links: map[string]string{"/usr/bin/test-link": "test"},
+		},
+		{
+			name: "hardlink-set",
+			files: []*spec.File{
+				{Source: "bin/test", Destination: "/usr/bin/test", Mode: "0755"},
+				{Destination: "/usr/bin/a-test", Type: spec.FileTypeHardlink, Target: "/usr/bin/test"},
+			},
+			expected: map[string]fs.FileMode{"/usr/bin/a-test": 0o755, "/usr/bin/test": 0o755},
+			links:    map[string]string{"/usr/bin/a-test": "", "/usr/bin/test": "/usr/bin/a-test"},
+		},
+		{
+			name: "synthetic-entries",
+			files: []*spec.File{
+				{Source: spec.DirSource, Destination: "/var/lib/test"},
+				{Destination: "/var/cache/test", Type: spec.FileTypeDir, Mode: "0700"},
+				{Destination: "/var/log/test.log", Type: spec.FileTypeGhost},
+			},
+			expected: map[string]fs.FileMode{
+				"/var/cache/test":   fs.ModeDir | 0o700,
+				"/var/lib/test":     fs.ModeDir | 0o755,
+				"/var/log/test.log": 0o644,
+			},
+		},
+		{
+			name:    "invalid-mode",
+			files:   []*spec.File{{Source: "bin/test", Destination: "/usr/bin/test", Mode: "999"}},
+			mustErr: true,
+		},
+		{
+			name:    "not-staged",
+			files:   []*spec.File{{Source: "bin/missing", Destination: "/usr/bin/missing"}},
+			mustErr: true,
+		},
+		{
+			name: "hardlink-outside-package",
+			files: []*spec.File{
+				{Destination: "/usr/bin/a-test", Type: spec.FileTypeHardlink, Target: "/usr/bin/test"},
+			},
+			mustErr: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			res, err := Collect(root, &spec.Component{Name: "test", Files: tc.files})
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			modes := map[string]fs.FileMode{}
+			paths := []string{}
+			for _, e := range res {
+				modes[e.Path] = e.Mode
+				paths = append(paths, e.Path)
+				if l, ok := tc.links[e.Path]; ok {
+					require.Equal(t, l, e.Linkname, e.Path)
+				}
+			}
+			require.Equal(t, tc.expected, modes)
+			require.IsIncreasing(t, paths)
+		})
+	}
+}
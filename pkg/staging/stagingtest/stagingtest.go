@@ -0,0 +1,65 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package stagingtest provides the fixtures shared by the tests of the
+// package writers: a build context, a staging directory and a manifest
+// that ships a single executable.
+package stagingtest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/uservers/baggr/pkg/build"
+	"github.com/uservers/baggr/pkg/spec"
+	"github.com/uservers/baggr/pkg/version"
+)
+
+// Executable is the content of the /usr/bin/test file in the staging
+// directory
+const Executable = "#!/bin/sh\n"
+
+// Context returns a context with a build context that holds the version
+// used to name the packages
+func Context(ver, release string) context.Context {
+	return context.WithValue(context.Background(), build.ContextKey{}, build.Context{
+		Version: &version.Spec{String: ver, Release: release},
+	})
+}
+
+// Dir returns a staging directory with the /usr/bin/test executable and the
+// files passed, keyed by their slash separated path in the directory.
+func Dir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeFile(t, dir, "usr/bin/test", Executable)
+	for p, content := range files {
+		writeFile(t, dir, p, content)
+	}
+	return dir
+}
+
+// writeFile writes a file in the staging directory creating its parents
+func writeFile(t *testing.T, dir, p, content string) {
+	t.Helper()
+	path := filepath.Join(dir, filepath.FromSlash(p))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.FileMode(0o755)))
+	require.NoError(t, os.WriteFile(path, []byte(content), os.FileMode(0o644)))
+}
+
+// Manifest returns the manifest of the test package, which installs the
+// staged executable in /usr/bin/test followed by the files passed.
+func Manifest(files ...*spec.File) *spec.Manifest {
+	return &spec.Manifest{
+		Component: spec.Component{
+			Name:    "test",
+			Summary: "Test project",
+			Files: append([]*spec.File{
+				{Source: "bin/test", Destination: "/usr/bin/test", Mode: "0755"},
+			}, files...),
+		},
+	}
+}
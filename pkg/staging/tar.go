@@ -0,0 +1,135 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package staging
+
+import (
+	"archive/tar"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// WithParents returns the entry list with entries added for the parent
+// directories not defined in the manifest. Added directories are owned by
+// root with mode 0755.
+func WithParents(entries []*Entry) []*Entry {
+	known := map[string]struct{}{}
+	for _, e := range entries {
+		known[e.Path] = struct{}{}
+	}
+
+	res := []*Entry{}
+	for _, e := range entries {
+		parents := []*Entry{}
+		for dir := path.Dir(e.Path); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			if _, ok := known[dir]; ok {
+				break
+			}
+			known[dir] = struct{}{}
+			parents = append([]*Entry{{
+				Path:    dir,
+				Mode:    fs.ModeDir | 0o755,
+				Owner:   DefaultOwner,
+				Group:   DefaultOwner,
+				ModTime: e.ModTime,
+			}}, parents...)
+		}
+		res = append(res, parents...)
+		res = append(res, e)
+	}
+	return res
+}
+
+// TarHeader returns a tar header for the entry. The name is the entry
+// path relative to the root directory, directories end with a slash.
+func (e *Entry) TarHeader() *tar.Header {
+	hdr := &tar.Header{
+		Name:    strings.TrimPrefix(e.Path, "/"),
+		Mode:    int64(e.Mode.Perm()),
+		Uid:     e.UID,
+		Gid:     e.GID,
+		Uname:   e.Owner,
+		Gname:   e.Group,
+		ModTime: e.ModTime.Truncate(time.Second),
+		Format:  tar.FormatGNU,
+	}
+	if e.Mode&fs.ModeSetuid != 0 {
+		hdr.Mode |= 0o4000
+	}
+	if e.Mode&fs.ModeSetgid != 0 {
+		hdr.Mode |= 0o2000
+	}
+	if e.Mode&fs.ModeSticky != 0 {
+		hdr.Mode |= 0o1000
+	}
+
+	switch {
+	case e.IsDir():
+		hdr.Typeflag = tar.TypeDir
+		hdr.Name += "/"
+	case e.IsSymlink():
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Linkname = e.Linkname
+	case e.IsHardlink():
+		hdr.Typeflag = tar.TypeLink
+		hdr.Linkname = strings.TrimPrefix(e.Linkname, "/")
+	default:
+		hdr.Typeflag = tar.TypeReg
+		hdr.Size = e.Size
+	}
+	return hdr
+}
+
+// WriteTar writes the entries to a tar stream, prefixing the names with
+// prefix. It does not close the tar writer.
+func WriteTar(tw *tar.Writer, prefix string, entries []*Entry) error {
+	for _, e := range entries {
+		hdr := e.TarHeader()
+		hdr.Name = prefix + hdr.Name
+		if hdr.Typeflag == tar.TypeLink {
+			hdr.Linkname = prefix + hdr.Linkname
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing tar header for %s: %w", e.Path, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := e.CopyTo(tw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyTo copies the data of the staged file to w
+func (e *Entry) CopyTo(w io.Writer) error {
+	f, err := e.Open()
+	if err != nil {
+		return fmt.Errorf("opening staged file: %w", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("copying %s: %w", e.Path, err)
+	}
+	return nil
+}
+
+// Digest returns the hex encoded digest of the entry data computed with h.
+// The digest of a symbolic link is computed from its target.
+func (e *Entry) Digest(h hash.Hash) (string, error) {
+	if e.IsSymlink() {
+		if _, err := io.WriteString(h, e.Linkname); err != nil {
+			return "", fmt.Errorf("hashing %s: %w", e.Path, err)
+		}
+	} else if err := e.CopyTo(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
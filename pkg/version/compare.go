@@ -0,0 +1,300 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"strconv"
+	"strings"
+)
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isAlpha(c byte) bool { return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') }
+
+// sign normalizes a comparison result to -1, 0 or 1
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// CompareRPM compares two rpm versions (or releases) following the rules
+// of rpmvercmp, including the tilde and caret operators. It returns -1, 0
+// or 1 if a is older, equal or newer than b.
+func CompareRPM(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for i < len(a) && !isDigit(a[i]) && !isAlpha(a[i]) && a[i] != '~' && a[i] != '^' {
+			i++
+		}
+		for j < len(b) && !isDigit(b[j]) && !isAlpha(b[j]) && b[j] != '~' && b[j] != '^' {
+			j++
+		}
+
+		// A tilde sorts before anything, even the end of the version
+		aTilde, bTilde := i < len(a) && a[i] == '~', j < len(b) && b[j] == '~'
+		if aTilde || bTilde {
+			if !aTilde {
+				return 1
+			}
+			if !bTilde {
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		// A caret sorts after the end of the version but before anything else
+		aCaret, bCaret := i < len(a) && a[i] == '^', j < len(b) && b[j] == '^'
+		if aCaret || bCaret {
+			switch {
+			case i == len(a):
+				return -1
+			case j == len(b):
+				return 1
+			case !aCaret:
+				return 1
+			case !bCaret:
+				return -1
+			}
+			i++
+			j++
+			continue
+		}
+
+		if i == len(a) || j == len(b) {
+			break
+		}
+
+		si, sj := i, j
+		numeric := isDigit(a[i])
+		match := isAlpha
+		if numeric {
+			match = isDigit
+		}
+		for i < len(a) && match(a[i]) {
+			i++
+		}
+		for j < len(b) && match(b[j]) {
+			j++
+		}
+		segA, segB := a[si:i], b[sj:j]
+
+		// Segments of different types: numeric ones are newer
+		if segB == "" {
+			if numeric {
+				return 1
+			}
+			return -1
+		}
+
+		if numeric {
+			if c := compareNumeric(segA, segB); c != 0 {
+				return c
+			}
+			continue
+		}
+		if c := strings.Compare(segA, segB); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case i >= len(a) && j >= len(b):
+		return 0
+	case i >= len(a):
+		return -1
+	}
+	return 1
+}
+
+// compareNumeric compares two strings of digits of any length
+func compareNumeric(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return sign(len(a) - len(b))
+	}
+	return strings.Compare(a, b)
+}
+
+// CompareDeb compares two debian versions, including their epoch and
+// revision, following the dpkg ordering rules. It returns -1, 0 or 1 if a
+// is older, equal or newer than b.
+func CompareDeb(a, b string) int {
+	epochA, upstreamA, revisionA := splitDeb(a)
+	epochB, upstreamB, revisionB := splitDeb(b)
+	if epochA != epochB {
+		return sign(epochA - epochB)
+	}
+	if c := compareDebPart(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return compareDebPart(revisionA, revisionB)
+}
+
+// splitDeb splits a debian version in epoch, upstream version and revision
+func splitDeb(v string) (epoch int, upstream, revision string) {
+	if e, rest, ok := strings.Cut(v, ":"); ok {
+		if n, err := strconv.Atoi(e); err == nil {
+			epoch = n
+			v = rest
+		}
+	}
+	if i := strings.LastIndex(v, "-"); i != -1 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// debOrder returns the weight of a character in the non-digit parts of a
+// debian version: the tilde sorts before everything, then the end of the
+// part, then letters and then the rest of the characters
+func debOrder(s string, i int) int {
+	switch {
+	case i >= len(s):
+		return 0
+	case isDigit(s[i]):
+		return 0
+	case isAlpha(s[i]):
+		return int(s[i])
+	case s[i] == '~':
+		return -1
+	}
+	return int(s[i]) + 256
+}
+
+// compareDebPart implements the dpkg verrevcmp algorithm
+func compareDebPart(a, b string) int {
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			if oa, ob := debOrder(a, i), debOrder(b, j); oa != ob {
+				return sign(oa - ob)
+			}
+			i++
+			j++
+		}
+		i, j = min(i, len(a)), min(j, len(b))
+
+		si, sj := i, j
+		for i < len(a) && isDigit(a[i]) {
+			i++
+		}
+		for j < len(b) && isDigit(b[j]) {
+			j++
+		}
+		if c := compareNumeric(a[si:i], b[sj:j]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// apkSuffixOrder is the ordering of the apk suffixes, a version without
+// suffix sorts between rc and cvs
+var apkSuffixOrder = map[string]int{
+	"alpha": 0,
+	"beta":  1,
+	"pre":   2,
+	"rc":    3,
+	"":      4,
+	"cvs":   5,
+	"svn":   6,
+	"git":   7,
+	"hg":    8,
+	"p":     9,
+}
+
+type apkSuffix struct {
+	order  int
+	number string
+}
+
+type apkVersion struct {
+	numbers  []string
+	letter   byte
+	suffixes []apkSuffix
+	revision string
+}
+
+// parseAPK parses a version in the apk format:
+// 1.2.3[letter][_suffix[number]...][~hash][-rN]
+func parseAPK(v string) apkVersion {
+	res := apkVersion{numbers: []string{}, suffixes: []apkSuffix{}}
+	if i := strings.LastIndex(v, "-r"); i != -1 {
+		res.revision = v[i+2:]
+		v = v[:i]
+	}
+	v, _, _ = strings.Cut(v, "~")
+
+	core, suffixes, _ := strings.Cut(v, "_")
+	if n := len(core); n > 0 && isAlpha(core[n-1]) {
+		res.letter = core[n-1]
+		core = core[:n-1]
+	}
+	res.numbers = strings.Split(core, ".")
+
+	if suffixes == "" {
+		return res
+	}
+	for _, s := range strings.Split(suffixes, "_") {
+		end := 0
+		for end < len(s) && isAlpha(s[end]) {
+			end++
+		}
+		order, ok := apkSuffixOrder[s[:end]]
+		if !ok {
+			order = apkSuffixOrder["pre"]
+		}
+		res.suffixes = append(res.suffixes, apkSuffix{order: order, number: s[end:]})
+	}
+	return res
+}
+
+// CompareAPK compares two apk versions, including their revision. It
+// returns -1, 0 or 1 if a is older, equal or newer than b.
+func CompareAPK(a, b string) int {
+	va, vb := parseAPK(a), parseAPK(b)
+
+	for k := 0; k < len(va.numbers) && k < len(vb.numbers); k++ {
+		if c := compareNumeric(va.numbers[k], vb.numbers[k]); c != 0 {
+			return c
+		}
+	}
+	if len(va.numbers) != len(vb.numbers) {
+		return sign(len(va.numbers) - len(vb.numbers))
+	}
+
+	if va.letter != vb.letter {
+		return sign(int(va.letter) - int(vb.letter))
+	}
+
+	none := apkSuffix{order: apkSuffixOrder[""]}
+	for k := 0; k < len(va.suffixes) || k < len(vb.suffixes); k++ {
+		sa, sb := none, none
+		if k < len(va.suffixes) {
+			sa = va.suffixes[k]
+		}
+		if k < len(vb.suffixes) {
+			sb = vb.suffixes[k]
+		}
+		if sa.order != sb.order {
+			return sign(sa.order - sb.order)
+		}
+		if c := compareNumeric(sa.number, sb.number); c != 0 {
+			return c
+		}
+	}
+
+	return compareNumeric(va.revision, vb.revision)
+}
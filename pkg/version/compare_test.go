@@ -0,0 +1,102 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareRPM(t *testing.T) {
+	t.Parallel()
+	// Cases from the rpmvercmp test suite
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0.1", 0},
+		{"2.0", "2.0.1", -1},
+		{"2.0.1a", "2.0.1", 1},
+		{"5.5p1", "5.5p2", -1},
+		{"5.5p10", "5.5p1", 1},
+		{"10xyz", "10.1xyz", -1},
+		{"xyz10", "xyz10.1", -1},
+		{"xyz.4", "8", -1},
+		{"5.5p1", "5.5.p1", 0},
+		{"1.0010", "1.9", 1},
+		{"1.05", "1.5", 0},
+		{"1b.fc17", "1.fc17", -1},
+		{"6.0.rc1", "6.0", 1},
+		{"10b2", "10a1", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0~rc1~git123", "1.0~rc1", -1},
+		{"1.0^", "1.0", 1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.01", -1},
+		{"1.0^git1", "1.0^git2", -1},
+		{"1.0^git1", "1.0.1", -1},
+		{"1.0~rc1^git1", "1.0~rc1", 1},
+		{"1.0^git1~pre", "1.0^git1", -1},
+	} {
+		require.Equal(t, tc.expected, CompareRPM(tc.a, tc.b), "%s <=> %s", tc.a, tc.b)
+		require.Equal(t, -tc.expected, CompareRPM(tc.b, tc.a), "%s <=> %s", tc.b, tc.a)
+	}
+}
+
+func TestCompareDeb(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.0-10", "1.0-9", 1},
+		{"1:1.0", "2.0", 1},
+		{"0:1.0", "1.0", 0},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~~", "1.0~", -1},
+		{"1.0~", "1.0", -1},
+		{"1.0", "1.0a", -1},
+		{"1.0a", "1.0+", -1},
+		{"1.0+dfsg", "1.0", 1},
+		{"1.0.1", "1.0+1", 1},
+		{"1.2.0~rc.1-1", "1.2.0-1", -1},
+		{"2.0-1", "10.0-1", -1},
+		{"1.001", "1.1", 0},
+	} {
+		require.Equal(t, tc.expected, CompareDeb(tc.a, tc.b), "%s <=> %s", tc.a, tc.b)
+		require.Equal(t, -tc.expected, CompareDeb(tc.b, tc.a), "%s <=> %s", tc.b, tc.a)
+	}
+}
+
+func TestCompareAPK(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "1.0.1", -1},
+		{"1.0-r1", "1.0-r2", -1},
+		{"1.0-r10", "1.0-r9", 1},
+		{"1.0_rc1", "1.0", -1},
+		{"1.0_alpha1", "1.0_beta1", -1},
+		{"1.0_beta2", "1.0_beta10", -1},
+		{"1.0_pre1", "1.0_rc1", -1},
+		{"1.0_p1", "1.0", 1},
+		{"1.0_git20240101", "1.0_p1", -1},
+		{"1.0a", "1.0", 1},
+		{"1.0a", "1.0b", -1},
+		{"1.0_rc1-r5", "1.0-r0", -1},
+		{"2.10", "2.9", 1},
+	} {
+		require.Equal(t, tc.expected, CompareAPK(tc.a, tc.b), "%s <=> %s", tc.a, tc.b)
+		require.Equal(t, -tc.expected, CompareAPK(tc.b, tc.a), "%s <=> %s", tc.b, tc.a)
+	}
+}
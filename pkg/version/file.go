@@ -0,0 +1,295 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the files supported by the FileReader
+const (
+	FormatPlain = "plain"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatTOML  = "toml"
+	FormatGo    = "go"
+)
+
+// FileReader reads the version recorded in a project file, such as a
+// VERSION file, package.json, Cargo.toml or a constant in a go source file.
+type FileReader struct {
+	Path   string
+	Format string
+	Key    string
+}
+
+// NewFileReader returns a reader for the file. If format or key are empty
+// they are guessed from the file name.
+func NewFileReader(path, format, key string) *FileReader {
+	base := filepath.Base(path)
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(base)) {
+		case ".json":
+			format = FormatJSON
+		case ".yaml", ".yml":
+			format = FormatYAML
+		case ".toml":
+			format = FormatTOML
+		case ".go":
+			format = FormatGo
+		default:
+			format = FormatPlain
+		}
+	}
+
+	if key == "" {
+		switch {
+		case base == "Cargo.toml":
+			key = "package.version"
+		case base == "pyproject.toml":
+			key = "project.version"
+		case format == FormatGo:
+			key = "Version"
+		default:
+			key = "version"
+		}
+	}
+	return &FileReader{Path: path, Format: format, Key: key}
+}
+
+// GetLastVersion reads the version from the file. A "v" prefix in the
+// version is dropped.
+func (fr *FileReader) GetLastVersion(_ context.Context) (*Spec, error) {
+	data, err := os.ReadFile(fr.Path)
+	if err != nil {
+		return nil, fmt.Errorf("reading version file: %w", err)
+	}
+
+	var v string
+	switch fr.Format {
+	case FormatPlain:
+		v = strings.TrimSpace(string(data))
+	case FormatJSON:
+		// Numbers are decoded with their text, 1.10 is not 1.1
+		var doc any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("parsing json: %w", err)
+		}
+		v, err = lookupKey(doc, fr.Key)
+	case FormatYAML:
+		doc := yaml.Node{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("parsing yaml: %w", err)
+		}
+		v, err = lookupYAMLKey(&doc, fr.Key)
+	case FormatTOML:
+		v, err = lookupTOMLKey(data, fr.Key)
+	case FormatGo:
+		v, err = lookupGoConstant(fr.Path, data, fr.Key)
+	default:
+		return nil, fmt.Errorf("unsupported version file format %q", fr.Format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading version from %s: %w", fr.Path, err)
+	}
+
+	if len(v) > 1 && v[0] == 'v' && isDigit(v[1]) {
+		v = v[1:]
+	}
+	if v == "" {
+		return nil, fmt.Errorf("version in %s is empty", fr.Path)
+	}
+	return &Spec{String: v, Release: "0"}, nil
+}
+
+// ComputeNextVersion returns the version unchanged, the file already
+// records the version being released.
+func (fr *FileReader) ComputeNextVersion(_ context.Context, last *Spec) (*Spec, error) {
+	if last == nil {
+		return nil, fmt.Errorf("no version read from %s", fr.Path)
+	}
+	return &Spec{String: last.String, Release: last.Release}, nil
+}
+
+// lookupKey walks the decoded json document following the dotted key path
+func lookupKey(doc any, key string) (string, error) {
+	cur := doc
+	for _, part := range strings.Split(key, ".") {
+		switch m := cur.(type) {
+		case map[string]any:
+			cur = m[part]
+		default:
+			return "", fmt.Errorf("key %q not found", key)
+		}
+		if cur == nil {
+			return "", fmt.Errorf("key %q not found", key)
+		}
+	}
+
+	switch v := cur.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("value of %q is not a string", key)
+	}
+}
+
+// lookupYAMLKey walks the yaml document following the dotted key path.
+// Scalars are returned as written in the file, so unquoted versions such
+// as 1.10 keep their text.
+func lookupYAMLKey(doc *yaml.Node, key string) (string, error) {
+	if len(doc.Content) == 0 {
+		return "", fmt.Errorf("key %q not found", key)
+	}
+	cur := doc.Content[0]
+	for _, part := range strings.Split(key, ".") {
+		if cur.Kind == yaml.AliasNode {
+			cur = cur.Alias
+		}
+		if cur.Kind != yaml.MappingNode {
+			return "", fmt.Errorf("key %q not found", key)
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(cur.Content); i += 2 {
+			if cur.Content[i].Value == part {
+				next = cur.Content[i+1]
+			}
+		}
+		if next == nil {
+			return "", fmt.Errorf("key %q not found", key)
+		}
+		cur = next
+	}
+	if cur.Kind == yaml.AliasNode {
+		cur = cur.Alias
+	}
+
+	switch {
+	case cur.Kind == yaml.ScalarNode && cur.ShortTag() == "!!null":
+		return "", fmt.Errorf("key %q not found", key)
+	case cur.Kind == yaml.ScalarNode && slices.Contains([]string{"!!str", "!!int", "!!float"}, cur.ShortTag()):
+		return cur.Value, nil
+	default:
+		return "", fmt.Errorf("value of %q is not a string", key)
+	}
+}
+
+// lookupTOMLKey finds a string value in a toml document. It understands
+// tables and dotted keys, which is enough to read versions from files
+// like Cargo.toml or pyproject.toml.
+func lookupTOMLKey(data []byte, key string) (string, error) {
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "[["):
+			// Values in arrays of tables are not addressable with a key path
+			table = "\x00"
+			continue
+		case strings.HasPrefix(line, "["):
+			table = tomlKey(strings.TrimPrefix(strings.SplitN(line, "]", 2)[0], "["))
+			continue
+		}
+
+		k, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		fullKey := tomlKey(k)
+		if table != "" {
+			fullKey = table + "." + fullKey
+		}
+		if fullKey != key {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) < 2 {
+			return "", fmt.Errorf("value of %q is not a string", key)
+		}
+		switch value[0] {
+		case '"':
+			end := strings.Index(value[1:], `"`)
+			if end == -1 {
+				return "", fmt.Errorf("unterminated string in %q", key)
+			}
+			return strconv.Unquote(value[:end+2])
+		case '\'':
+			end := strings.Index(value[1:], "'")
+			if end == -1 {
+				return "", fmt.Errorf("unterminated string in %q", key)
+			}
+			return value[1 : end+1], nil
+		default:
+			return "", fmt.Errorf("value of %q is not a string", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("scanning toml: %w", err)
+	}
+	return "", fmt.Errorf("key %q not found", key)
+}
+
+// tomlKey normalizes a toml key, removing quotes and the spaces around dots
+func tomlKey(k string) string {
+	parts := strings.Split(k, ".")
+	for i := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(parts[i]), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+// lookupGoConstant returns the value of a string constant or variable
+// declared at the top level of a go source file
+func lookupGoConstant(path string, data []byte, name string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, data, parser.SkipObjectResolution)
+	if err != nil {
+		return "", fmt.Errorf("parsing go file: %w", err)
+	}
+
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || (gd.Tok != token.CONST && gd.Tok != token.VAR) {
+			continue
+		}
+		for _, s := range gd.Specs {
+			vs, ok := s.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for i, n := range vs.Names {
+				if n.Name != name || i >= len(vs.Values) {
+					continue
+				}
+				lit, ok := vs.Values[i].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return "", fmt.Errorf("%s is not a string literal", name)
+				}
+				return strconv.Unquote(lit.Value)
+			}
+		}
+	}
+	return "", fmt.Errorf("%s not declared in file", name)
+}
@@ -0,0 +1,75 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileReader(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		file     string
+		data     string
+		format   string
+		key      string
+		expected string
+		mustErr  bool
+	}{
+		{"plain", "VERSION", "v1.2.3\n", "", "", "1.2.3", false},
+		{"plain-empty", "VERSION", "\n", "", "", "", true},
+		{"package.json", "package.json", `{"name": "x", "version": "2.0.1"}`, "", "", "2.0.1", false},
+		{"json-key", "meta.json", `{"build": {"release": "3.1"}}`, "", "build.release", "3.1", false},
+		{"json-missing", "meta.json", `{"build": {}}`, "", "build.release", "", true},
+		{"json-number", "meta.json", `{"version": 1.10}`, "", "", "1.10", false},
+		{"json-bool", "meta.json", `{"version": true}`, "", "", "", true},
+		{"yaml", "chart.yaml", "appVersion: 0.9.0\nversion: 1.0.0\n", "", "appVersion", "0.9.0", false},
+		{"yaml-number", "chart.yaml", "version: 1.10\n", "", "", "1.10", false},
+		{"yaml-integer", "chart.yaml", "version: 1.0\nbuild:\n  major: 2\n", "", "build.major", "2", false},
+		{"yaml-nested", "meta.yaml", "build:\n  release: 1.0\n", "", "build.release", "1.0", false},
+		{"yaml-null", "meta.yaml", "version: ~\n", "", "", "", true},
+		{"yaml-not-scalar", "meta.yaml", "version:\n  - 1.0\n", "", "", "", true},
+		{"yaml-bool", "meta.yaml", "version: true\n", "", "", "", true},
+		{
+			"cargo", "Cargo.toml",
+			"[workspace]\nversion = \"0.0.1\"\n\n[package]\nname = \"x\"\nversion = \"1.4.2\" # comment\n",
+			"", "", "1.4.2", false,
+		},
+		{"pyproject", "pyproject.toml", "[project]\nname = 'x'\nversion = '5.0.0'\n", "", "", "5.0.0", false},
+		{"toml-dotted", "conf.toml", "package.version = \"1.1.1\"\n", "", "package.version", "1.1.1", false},
+		{
+			"go-const", "version.go",
+			"package main\n\nconst (\n\tName = \"x\"\n\tVersion = \"v0.3.0\"\n)\n",
+			"", "", "0.3.0", false,
+		},
+		{"go-var", "info.go", "package main\n\nvar AppVersion = `1.0.0`\n", "", "AppVersion", "1.0.0", false},
+		{"go-not-string", "version.go", "package main\n\nconst Version = 1\n", "", "", "", true},
+		{"explicit-format", "version.txt", "{\"version\": \"4.0.0\"}", FormatJSON, "", "4.0.0", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), tc.file)
+			require.NoError(t, os.WriteFile(path, []byte(tc.data), os.FileMode(0o644)))
+
+			reader := NewFileReader(path, tc.format, tc.key)
+			last, err := reader.GetLastVersion(context.Background())
+			if tc.mustErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, last.String)
+
+			next, err := reader.ComputeNextVersion(context.Background(), last)
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, next.String)
+		})
+	}
+}
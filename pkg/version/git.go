@@ -0,0 +1,147 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"sigs.k8s.io/release-utils/command"
+)
+
+// Bump is the part of a semantic version incremented by a set of changes
+type Bump int
+
+const (
+	BumpPatch Bump = iota
+	BumpMinor
+	BumpMajor
+)
+
+// conventionalHeader matches the header of a conventional commit message,
+// eg "feat(parser)!: support globs"
+var conventionalHeader = regexp.MustCompile(`^([a-zA-Z]+)(\([^)]*\))?(!)?: `)
+
+// GitReader computes versions from the semver tags of a git repository and
+// the conventional commit messages since the last one.
+type GitReader struct {
+	// Path is a directory in the repository
+	Path string
+}
+
+func NewGitReader(path string) *GitReader {
+	return &GitReader{Path: path}
+}
+
+// GetLastVersion returns the highest semver tag reachable from HEAD. The
+// returned version has no "v" prefix. If the repository has no version
+// tags it returns 0.0.0.
+func (gr *GitReader) GetLastVersion(_ context.Context) (*Spec, error) {
+	output, err := gr.git("tag", "--list", "--merged", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("listing repository tags: %w", err)
+	}
+
+	var last *semver.Version
+	for _, tag := range strings.Fields(output) {
+		v, err := semver.Parse(strings.TrimPrefix(tag, "v"))
+		if err != nil || len(v.Pre) > 0 {
+			continue
+		}
+		if last == nil || v.GT(*last) {
+			last = &v
+		}
+	}
+
+	if last == nil {
+		return &Spec{String: "0.0.0", Release: "0"}, nil
+	}
+	return &Spec{String: last.String(), Release: "0"}, nil
+}
+
+// ComputeNextVersion bumps the last version according to the messages of
+// the commits since its tag: fix bumps the patch version, feat the minor
+// and breaking changes the major. When HEAD is the tagged commit the last
+// version is returned unchanged.
+func (gr *GitReader) ComputeNextVersion(_ context.Context, last *Spec) (*Spec, error) {
+	if last == nil {
+		return nil, fmt.Errorf("no previous version to compute from")
+	}
+	v, err := semver.Parse(strings.TrimPrefix(last.String, "v"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing last version %q: %w", last.String, err)
+	}
+
+	// Find the tag of the last version, without it we read the whole history
+	logArgs := []string{"log", "--format=%B%x00"}
+	tagged := false
+	for _, tag := range []string{"v" + v.String(), v.String()} {
+		if _, err := gr.git("rev-parse", "--verify", "--quiet", "refs/tags/"+tag); err == nil {
+			logArgs = append(logArgs, tag+"..HEAD")
+			tagged = true
+			break
+		}
+	}
+
+	output, err := gr.git(logArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("reading commit messages: %w", err)
+	}
+
+	messages := []string{}
+	for _, m := range strings.Split(output, "\x00") {
+		if m = strings.TrimSpace(m); m != "" {
+			messages = append(messages, m)
+		}
+	}
+	if tagged && len(messages) == 0 {
+		return last, nil
+	}
+
+	switch ComputeBump(messages) {
+	case BumpMajor:
+		err = v.IncrementMajor()
+	case BumpMinor:
+		err = v.IncrementMinor()
+	default:
+		err = v.IncrementPatch()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("incrementing version: %w", err)
+	}
+
+	return &Spec{String: v.String(), Release: "0"}, nil
+}
+
+// ComputeBump returns the highest bump required by the commit messages.
+// Messages that don't follow the conventional commit format count as
+// patches.
+func ComputeBump(messages []string) Bump {
+	bump := BumpPatch
+	for _, msg := range messages {
+		header, body, _ := strings.Cut(msg, "\n")
+		m := conventionalHeader.FindStringSubmatch(header)
+		switch {
+		case m != nil && m[3] == "!",
+			strings.Contains(body, "BREAKING CHANGE:"),
+			strings.Contains(body, "BREAKING-CHANGE:"):
+			return BumpMajor
+		case m != nil && strings.EqualFold(m[1], "feat"):
+			bump = BumpMinor
+		}
+	}
+	return bump
+}
+
+// git runs a git subcommand in the reader path and returns its output
+func (gr *GitReader) git(args ...string) (string, error) {
+	output, err := command.NewWithWorkDir(gr.Path, "git", args...).RunSilentSuccessOutput()
+	if err != nil {
+		return "", err
+	}
+	return output.OutputTrimNL(), nil
+}
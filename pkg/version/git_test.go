@@ -0,0 +1,98 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeBump(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		name     string
+		messages []string
+		expected Bump
+	}{
+		{"no-messages", []string{}, BumpPatch},
+		{"non-conventional", []string{"Update README"}, BumpPatch},
+		{"fix", []string{"fix: handle empty files"}, BumpPatch},
+		{"feat", []string{"fix: typo", "feat(rpm): add native writer"}, BumpMinor},
+		{"bang", []string{"feat: x", "refactor!: drop old flags"}, BumpMajor},
+		{"scoped-bang", []string{"feat(cli)!: rename build"}, BumpMajor},
+		{"footer", []string{"fix: x\n\nBREAKING CHANGE: the api changed"}, BumpMajor},
+		{"not-a-type", []string{"feature: something"}, BumpPatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tc.expected, ComputeBump(tc.messages))
+		})
+	}
+}
+
+func TestGitReader(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{
+			"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false",
+		}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	ctx := context.Background()
+	reader := NewGitReader(dir)
+
+	git("init", "-q")
+	git("commit", "-q", "--allow-empty", "-m", "Initial commit")
+
+	// No tags, versions start from zero
+	last, err := reader.GetLastVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.0", last.String)
+	next, err := reader.ComputeNextVersion(ctx, last)
+	require.NoError(t, err)
+	require.Equal(t, "0.0.1", next.String)
+
+	git("tag", "v1.2.3")
+	git("tag", "v1.3.0-rc.1")
+	git("tag", "not-a-version")
+
+	// HEAD is the tagged commit, the version is not bumped
+	last, err = reader.GetLastVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3", last.String)
+	next, err = reader.ComputeNextVersion(ctx, last)
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3", next.String)
+
+	git("commit", "-q", "--allow-empty", "-m", "fix: a bug")
+
+	last, err = reader.GetLastVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3", last.String)
+	next, err = reader.ComputeNextVersion(ctx, last)
+	require.NoError(t, err)
+	require.Equal(t, "1.2.4", next.String)
+
+	git("commit", "-q", "--allow-empty", "-m", "feat: new thing")
+	next, err = reader.ComputeNextVersion(ctx, last)
+	require.NoError(t, err)
+	require.Equal(t, "1.3.0", next.String)
+
+	// Commits before the tag are not considered
+	git("tag", "1.3.0")
+	git("commit", "-q", "--allow-empty", "-m", "docs: update readme")
+	last, err = reader.GetLastVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "1.3.0", last.String)
+	next, err = reader.ComputeNextVersion(ctx, last)
+	require.NoError(t, err)
+	require.Equal(t, "1.3.1", next.String)
+}
@@ -0,0 +1,238 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FirstRelease is the release of a version never built before
+const FirstRelease = 1
+
+// ReleaseResolver computes the next release of a version from the packages
+// already built. It reads the artifact file names in a directory and the
+// rpm-md (repodata/primary.xml) and apt (Packages) metadata found in it.
+type ReleaseResolver struct {
+	Dir string
+}
+
+func NewReleaseResolver(dir string) *ReleaseResolver {
+	return &ReleaseResolver{Dir: dir}
+}
+
+// NextRelease returns the release that follows the highest release found
+// for the package name and version.
+func (rr *ReleaseResolver) NextRelease(name, ver string) (string, error) {
+	last, err := rr.LastRelease(name, ver)
+	if err != nil {
+		return "", err
+	}
+	if last < 0 {
+		return strconv.Itoa(FirstRelease), nil
+	}
+	return strconv.Itoa(last + 1), nil
+}
+
+// LastRelease returns the highest release built for the package name and
+// version or -1 if there is none.
+func (rr *ReleaseResolver) LastRelease(name, ver string) (int, error) {
+	patterns := artifactPatterns(name, ver)
+	last := -1
+	record := func(rel string) {
+		if n, ok := releaseNumber(rel); ok && n > last {
+			last = n
+		}
+	}
+
+	err := filepath.WalkDir(rr.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		base := d.Name()
+		switch meta := strings.TrimSuffix(base, ".gz"); {
+		case meta == "primary.xml" || strings.HasSuffix(meta, "-primary.xml"):
+			rels, err := readPrimaryReleases(path, name, ver)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", path, err)
+			}
+			for _, rel := range rels {
+				record(rel)
+			}
+			return nil
+		case meta == "Packages":
+			rels, err := readAptReleases(path, name, ver)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", path, err)
+			}
+			for _, rel := range rels {
+				record(rel)
+			}
+			return nil
+		}
+
+		for _, re := range patterns {
+			if m := re.FindStringSubmatch(base); m != nil {
+				record(m[1])
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return -1, fmt.Errorf("scanning %s for releases: %w", rr.Dir, err)
+	}
+	return last, nil
+}
+
+// artifactPatterns returns the expressions that match the file names of the
+// packages baggr writes, with the version translated to each format. The
+// first group captures the release.
+func artifactPatterns(name, ver string) []*regexp.Regexp {
+	n := regexp.QuoteMeta(name)
+	return []*regexp.Regexp{
+		// rpm: name-version-release.arch.rpm
+		regexp.MustCompile(`^` + n + `-` + regexp.QuoteMeta(TranslateRPM(ver)) + `-(\d+)[^-]*\.[^.]+\.rpm$`),
+		// deb: name_version-release_arch.deb
+		regexp.MustCompile(`^(?i:` + n + `)_` + regexp.QuoteMeta(TranslateDeb(ver)) + `-(\d+)[^_]*_[^_]+\.deb$`),
+		// apk: name-version-rrelease.apk
+		regexp.MustCompile(`^(?i:` + n + `)-` + regexp.QuoteMeta(TranslateAPK(ver)) + `-r(\d+)\.apk$`),
+		// pacman: name-version-release-arch.pkg.tar.*
+		regexp.MustCompile(
+			`^(?i:` + n + `)-` + regexp.QuoteMeta(TranslatePacman(ver)) + `-(\d+)-[^-]+\.pkg\.tar\.[a-z0-9]+$`,
+		),
+	}
+}
+
+// releaseNumber returns the numeric prefix of a release, eg 3 for "3.el9"
+func releaseNumber(rel string) (int, bool) {
+	end := 0
+	for end < len(rel) && rel[end] >= '0' && rel[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(rel[:end])
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// openMaybeGzip opens a file, decompressing it if its name ends in .gz
+func openMaybeGzip(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, f}, nil
+}
+
+// readPrimaryReleases returns the releases of the package listed in an
+// rpm-md primary.xml file
+func readPrimaryReleases(path, name, ver string) ([]string, error) {
+	r, err := openMaybeGzip(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	type pkg struct {
+		Name    string `xml:"name"`
+		Version struct {
+			Ver string `xml:"ver,attr"`
+			Rel string `xml:"rel,attr"`
+		} `xml:"version"`
+	}
+
+	rels := []string{}
+	dec := xml.NewDecoder(r)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "package" {
+			continue
+		}
+		var p pkg
+		if err := dec.DecodeElement(&p, &se); err != nil {
+			return nil, err
+		}
+		if p.Name == name && p.Version.Ver == TranslateRPM(ver) {
+			rels = append(rels, p.Version.Rel)
+		}
+	}
+	return rels, nil
+}
+
+// readAptReleases returns the releases of the package listed in an apt
+// Packages index
+func readAptReleases(path, name, ver string) ([]string, error) {
+	r, err := openMaybeGzip(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	rels := []string{}
+	pkgName, pkgVersion := "", ""
+	check := func() {
+		if strings.EqualFold(pkgName, name) {
+			// Drop the epoch and split the debian revision
+			if _, v, ok := strings.Cut(pkgVersion, ":"); ok {
+				pkgVersion = v
+			}
+			if i := strings.LastIndex(pkgVersion, "-"); i != -1 && pkgVersion[:i] == TranslateDeb(ver) {
+				rels = append(rels, pkgVersion[i+1:])
+			}
+		}
+		pkgName, pkgVersion = "", ""
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			check()
+		case strings.HasPrefix(line, "Package:"):
+			pkgName = strings.TrimSpace(strings.TrimPrefix(line, "Package:"))
+		case strings.HasPrefix(line, "Version:"):
+			pkgVersion = strings.TrimSpace(strings.TrimPrefix(line, "Version:"))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	check()
+	return rels, nil
+}
@@ -0,0 +1,110 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testPrimary = `<?xml version="1.0" encoding="UTF-8"?>
+<metadata xmlns="http://linux.duke.edu/metadata/common" packages="3">
+<package type="rpm">
+  <name>hello</name>
+  <arch>noarch</arch>
+  <version epoch="0" ver="1.0.0" rel="7.el9"/>
+</package>
+<package type="rpm">
+  <name>hello</name>
+  <arch>noarch</arch>
+  <version epoch="0" ver="2.0.0" rel="12"/>
+</package>
+<package type="rpm">
+  <name>hello-docs</name>
+  <arch>noarch</arch>
+  <version epoch="0" ver="1.0.0" rel="20"/>
+</package>
+</metadata>
+`
+
+const testPackages = `Package: hello
+Version: 1.0.0-4
+Architecture: all
+
+Package: hello
+Version: 1:1.0.0-9
+Architecture: all
+
+Package: other
+Version: 1.0.0-30
+Architecture: all
+`
+
+func TestReleaseResolver(t *testing.T) {
+	t.Parallel()
+
+	writeFile := func(t *testing.T, path, content string) {
+		t.Helper()
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.FileMode(0o755)))
+		require.NoError(t, os.WriteFile(path, []byte(content), os.FileMode(0o644)))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		prepare  func(t *testing.T, dir string)
+		expected string
+	}{
+		{"empty", func(t *testing.T, dir string) { t.Helper() }, "1"},
+		{"artifacts", func(t *testing.T, dir string) {
+			t.Helper()
+			for _, f := range []string{
+				"hello-1.0.0-1.noarch.rpm",
+				"hello-1.0.0-3.noarch.rpm",
+				"hello-docs-1.0.0-8.noarch.rpm",
+				"hello-1.0.1-9.noarch.rpm",
+				"hello_1.0.0-2_all.deb",
+				"hello-1.0.0-r4.apk",
+				"hello-1.0.0-2-any.pkg.tar.zst",
+			} {
+				writeFile(t, filepath.Join(dir, f), "")
+			}
+		}, "5"},
+		{"nested", func(t *testing.T, dir string) {
+			t.Helper()
+			writeFile(t, filepath.Join(dir, "el9", "noarch", "hello-1.0.0-6.el9.noarch.rpm"), "")
+		}, "7"},
+		{"rpm-md", func(t *testing.T, dir string) {
+			t.Helper()
+			writeFile(t, filepath.Join(dir, "repodata", "primary.xml"), testPrimary)
+		}, "8"},
+		{"rpm-md-gz", func(t *testing.T, dir string) {
+			t.Helper()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, "repodata"), os.FileMode(0o755)))
+			f, err := os.Create(filepath.Join(dir, "repodata", "0123abcd-primary.xml.gz"))
+			require.NoError(t, err)
+			gz := gzip.NewWriter(f)
+			_, err = gz.Write([]byte(testPrimary))
+			require.NoError(t, err)
+			require.NoError(t, gz.Close())
+			require.NoError(t, f.Close())
+		}, "8"},
+		{"apt", func(t *testing.T, dir string) {
+			t.Helper()
+			writeFile(t, filepath.Join(dir, "dists", "stable", "main", "binary-all", "Packages"), testPackages)
+		}, "10"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			dir := t.TempDir()
+			tc.prepare(t, dir)
+			rel, err := NewReleaseResolver(dir).NextRelease("hello", "1.0.0")
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, rel)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"strings"
+)
+
+// apkSuffixes maps the usual prerelease names to the apk suffixes that sort
+// before a final version
+var apkSuffixes = map[string]string{
+	"alpha": "alpha",
+	"a":     "alpha",
+	"beta":  "beta",
+	"b":     "beta",
+	"pre":   "pre",
+	"rc":    "rc",
+}
+
+// splitSemver splits a version in its core, prerelease and build metadata
+// parts, dropping the "v" prefix of git tags. Versions that are not semver
+// are returned as the core.
+func splitSemver(v string) (core, pre, build string) {
+	if len(v) > 1 && v[0] == 'v' && isDigit(v[1]) {
+		v = v[1:]
+	}
+	v, build, _ = strings.Cut(v, "+")
+	core, pre, _ = strings.Cut(v, "-")
+	return core, pre, build
+}
+
+// TranslateRPM returns the version in a form valid for the rpm Version tag.
+// Prereleases are appended after a tilde so they sort before the final
+// version: 1.2.0-rc.1 becomes 1.2.0~rc.1.
+func TranslateRPM(v string) string {
+	core, pre, build := splitSemver(v)
+	res := core
+	if pre != "" {
+		res += "~" + strings.ReplaceAll(pre, "-", ".")
+	}
+	if build != "" {
+		res += "+" + strings.ReplaceAll(build, "-", ".")
+	}
+	return res
+}
+
+// TranslateDeb returns the version as a debian upstream version. It uses
+// the same tilde notation as rpm: 1.2.0-rc.1 becomes 1.2.0~rc.1.
+func TranslateDeb(v string) string {
+	return TranslateRPM(v)
+}
+
+// TranslateAPK returns the version in the format used by apk. The
+// prerelease becomes one of the apk suffixes: 1.2.0-rc.1 is 1.2.0_rc1 and
+// unknown prerelease names are translated to _pre. Build metadata is
+// not supported by apk and is dropped.
+func TranslateAPK(v string) string {
+	core, pre, _ := splitSemver(v)
+	if pre == "" {
+		return core
+	}
+
+	var b strings.Builder
+	b.WriteString(core)
+	suffix := false
+	for _, field := range splitAlnum(pre) {
+		if isDigit(field[0]) {
+			if !suffix {
+				b.WriteString("_pre")
+			}
+			b.WriteString(field)
+			suffix = false
+			continue
+		}
+		s, ok := apkSuffixes[strings.ToLower(field)]
+		if !ok {
+			s = "pre"
+		}
+		b.WriteString("_" + s)
+		suffix = true
+	}
+	return b.String()
+}
+
+// TranslatePacman returns the version as a pacman pkgver. The prerelease
+// is appended without a separator because pacman sorts a trailing alpha
+// segment before the final version: 1.2.0-rc.1 becomes 1.2.0rc.1. Build
+// metadata is dropped.
+func TranslatePacman(v string) string {
+	core, pre, _ := splitSemver(v)
+	if pre == "" {
+		return core
+	}
+	pre = strings.ReplaceAll(pre, "-", ".")
+	if isDigit(pre[0]) {
+		pre = "pre" + pre
+	}
+	return core + pre
+}
+
+// splitAlnum splits a string in runs of digits and letters, dropping any
+// other characters: "rc.1" and "rc1" both return ["rc", "1"]
+func splitAlnum(s string) []string {
+	res := []string{}
+	start := -1
+	digits := false
+	for i := 0; i <= len(s); i++ {
+		var c byte
+		if i < len(s) {
+			c = s[i]
+		}
+		alnum := isDigit(c) || isAlpha(c)
+		if start != -1 && (!alnum || isDigit(c) != digits) {
+			res = append(res, s[start:i])
+			start = -1
+		}
+		if start == -1 && alnum {
+			start = i
+			digits = isDigit(c)
+		}
+	}
+	return res
+}
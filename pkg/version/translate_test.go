@@ -0,0 +1,68 @@
+// SPDX-FileCopyrightText: Copyright 2024 U Servers Comunicaciones, S.C.
+// SPDX-License-Identifier: Apache-2.0
+
+package version
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslate(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		version string
+		rpm     string
+		deb     string
+		apk     string
+		pacman  string
+	}{
+		{"1.2.0", "1.2.0", "1.2.0", "1.2.0", "1.2.0"},
+		{"v1.2.0", "1.2.0", "1.2.0", "1.2.0", "1.2.0"},
+		{"v1.2.0-rc.1", "1.2.0~rc.1", "1.2.0~rc.1", "1.2.0_rc1", "1.2.0rc.1"},
+		{"1.2.0-rc1", "1.2.0~rc1", "1.2.0~rc1", "1.2.0_rc1", "1.2.0rc1"},
+		{"1.2.0-beta", "1.2.0~beta", "1.2.0~beta", "1.2.0_beta", "1.2.0beta"},
+		{"1.2.0-alpha.2", "1.2.0~alpha.2", "1.2.0~alpha.2", "1.2.0_alpha2", "1.2.0alpha.2"},
+		{"1.2.0-dev-3", "1.2.0~dev.3", "1.2.0~dev.3", "1.2.0_pre3", "1.2.0dev.3"},
+		{"1.2.0-1", "1.2.0~1", "1.2.0~1", "1.2.0_pre1", "1.2.0pre1"},
+		{"1.2.0+build.5", "1.2.0+build.5", "1.2.0+build.5", "1.2.0", "1.2.0"},
+		{"1.2.0-rc.1+abc", "1.2.0~rc.1+abc", "1.2.0~rc.1+abc", "1.2.0_rc1", "1.2.0rc.1"},
+		{"2024.01", "2024.01", "2024.01", "2024.01", "2024.01"},
+	} {
+		t.Run(tc.version, func(t *testing.T) {
+			t.Parallel()
+			require.Equal(t, tc.rpm, TranslateRPM(tc.version))
+			require.Equal(t, tc.deb, TranslateDeb(tc.version))
+			require.Equal(t, tc.apk, TranslateAPK(tc.version))
+			require.Equal(t, tc.pacman, TranslatePacman(tc.version))
+		})
+	}
+}
+
+// TestTranslateOrdering checks that translated versions keep the semver
+// ordering in each package format
+func TestTranslateOrdering(t *testing.T) {
+	t.Parallel()
+	ordered := []string{
+		"1.0.0", "v1.1.0-alpha.1", "1.1.0-beta.1", "1.1.0-beta.2", "1.1.0-rc.1", "v1.1.0", "1.1.1", "1.2.0-rc.1", "1.2.0",
+	}
+	for _, tc := range []struct {
+		name      string
+		translate func(string) string
+		compare   func(string, string) int
+	}{
+		{"rpm", TranslateRPM, CompareRPM},
+		{"deb", TranslateDeb, CompareDeb},
+		{"apk", TranslateAPK, CompareAPK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			for i := 1; i < len(ordered); i++ {
+				a, b := tc.translate(ordered[i-1]), tc.translate(ordered[i])
+				require.Equal(t, -1, tc.compare(a, b), "%s should be older than %s", a, b)
+				require.Equal(t, 1, tc.compare(b, a), "%s should be newer than %s", b, a)
+			}
+		})
+	}
+}